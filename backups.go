@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+const backupsDir = "backups"
+
+// Only the newest backups are kept, older ones are deleted when a new one is taken.
+const maxBackups = 20
+
+const backupTimeLayout = "20060102T150405Z"
+
+var errBackupNotFound = errors.New("backup not found")
+
+// backup is one snapshot directory holding a copy of resources.json and playlists.json.
+type backup struct {
+	Name      string
+	Path      string
+	Taken     time.Time
+	Reason    string
+	Resources int
+	Playlists int
+}
+
+// Function to snapshot the current resources and playlists before a bulk change
+func takeBackup(reason string) (string, error) {
+	resources, err := loadResources()
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	playlists, err := loadPlaylists()
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	name := time.Now().UTC().Format(backupTimeLayout) + "-" + reason
+	dir := filepath.Join(dataPath(backupsDir), name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	resources.Version, resources.EventSeq = resourcesSchemaVersion, 0
+	playlists.Version, playlists.EventSeq = playlistsSchemaVersion, 0
+	for file, v := range map[string]interface{}{resourcesFile: resources, playlistsFile: playlists} {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		if err := writeFileAtomic(filepath.Join(dir, file), data, 0644); err != nil {
+			return "", err
+		}
+	}
+	return name, rotateBackups()
+}
+
+// Function to take a backup before a bulk change and tell the user its name
+func backupBefore(reason string) error {
+	name, err := takeBackup(reason)
+	if err != nil {
+		return fmt.Errorf("taking a backup before %s: %w", reason, err)
+	}
+	color.Cyan("Backup taken: %s", name)
+	return nil
+}
+
+// Function to delete the oldest backups beyond maxBackups
+func rotateBackups() error {
+	backups, err := listBackups()
+	if err != nil {
+		return err
+	}
+	for i := maxBackups; i < len(backups); i++ {
+		if err := os.RemoveAll(backups[i].Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to read the backups directory, newest first
+func listBackups() ([]backup, error) {
+	dir := dataPath(backupsDir)
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backup
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		stamp, reason, _ := strings.Cut(e.Name(), "-")
+		taken, err := time.Parse(backupTimeLayout, stamp)
+		if err != nil {
+			continue // not made by outgo
+		}
+		b := backup{Name: e.Name(), Path: filepath.Join(dir, e.Name()), Taken: taken, Reason: reason}
+		if resources, err := readBackupResources(b); err == nil {
+			b.Resources = len(resources.List)
+		}
+		if playlists, err := readBackupPlaylists(b); err == nil {
+			b.Playlists = len(playlists.List)
+		}
+		backups = append(backups, b)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name > backups[j].Name })
+	return backups, nil
+}
+
+func readBackupResources(b backup) (Resources, error) {
+	var resources Resources
+	f := jsonFile{path: filepath.Join(b.Path, resourcesFile), listKey: "resources", chain: resourceMigrations}
+	return resources, f.read(&resources)
+}
+
+func readBackupPlaylists(b backup) (Playlists, error) {
+	var playlists Playlists
+	f := jsonFile{path: filepath.Join(b.Path, playlistsFile), listKey: "playlists", chain: playlistMigrations}
+	return playlists, f.read(&playlists)
+}
+
+// Function to show the available backups with their item counts
+func showBackups() error {
+	backups, err := listBackups()
+	if err != nil {
+		return fmt.Errorf("reading backups: %w", err)
+	}
+	if len(backups) == 0 {
+		color.Yellow("No backups yet. One is taken automatically before every bulk change.")
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader([]string{"#", "Snapshot", "Taken", "Reason", "Resources", "Playlists"})
+	for i, b := range backups {
+		table.Append([]string{
+			strconv.Itoa(i + 1),
+			b.Name,
+			b.Taken.Local().Format("2006-01-02 15:04:05"),
+			b.Reason,
+			strconv.Itoa(b.Resources),
+			strconv.Itoa(b.Playlists),
+		})
+	}
+	table.Render()
+	fmt.Println("Use `restore <#|snapshot>` to roll back to one of them.")
+	return nil
+}
+
+// catalogDiff lists how one catalog differs from another.
+type catalogDiff struct {
+	Added   []Resource
+	Removed []Resource
+	Changed []resourcePair
+}
+
+type resourcePair struct {
+	Old, New Resource
+}
+
+// Function to compare two catalogs by resource ID
+func diffCatalogs(from, to []Resource) catalogDiff {
+	var d catalogDiff
+	old := make(map[string]Resource, len(from))
+	for _, r := range from {
+		old[strings.ToLower(r.ID)] = r
+	}
+	seen := make(map[string]bool, len(to))
+	for _, r := range to {
+		key := strings.ToLower(r.ID)
+		seen[key] = true
+		if o, ok := old[key]; !ok {
+			d.Added = append(d.Added, r)
+		} else if !sameJSON(o, r) {
+			d.Changed = append(d.Changed, resourcePair{Old: o, New: r})
+		}
+	}
+	for _, r := range from {
+		if !seen[strings.ToLower(r.ID)] {
+			d.Removed = append(d.Removed, r)
+		}
+	}
+	return d
+}
+
+func (d catalogDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Function to print a diff, at most limit lines per section
+func printCatalogDiff(d catalogDiff, limit int) {
+	section := func(c *color.Color, sign string, items []string) {
+		for i, item := range items {
+			if i == limit {
+				c.Printf("  ... and %d more\n", len(items)-limit)
+				break
+			}
+			c.Printf("%s %s\n", sign, item)
+		}
+	}
+	var added, removed, changed []string
+	for _, r := range d.Added {
+		added = append(added, fmt.Sprintf("%s  %s", r.ID, r.Title))
+	}
+	for _, r := range d.Removed {
+		removed = append(removed, fmt.Sprintf("%s  %s", r.ID, r.Title))
+	}
+	for _, p := range d.Changed {
+		changed = append(changed, fmt.Sprintf("%s  %s (%s)", p.New.ID, p.New.Title, strings.Join(changedFields(p.Old, p.New), ", ")))
+	}
+	section(color.New(color.FgGreen), "+", added)
+	section(color.New(color.FgRed), "-", removed)
+	section(color.New(color.FgYellow), "~", changed)
+	if len(d.Removed) > 0 {
+		fmt.Printf("%d added, %d removed, %d changed\n", len(d.Added), len(d.Removed), len(d.Changed))
+	} else {
+		fmt.Printf("%d added, %d changed\n", len(d.Added), len(d.Changed))
+	}
+}
+
+// Function to name the fields that differ between two versions of a resource
+func changedFields(a, b Resource) []string {
+	var fields []string
+	if a.Title != b.Title {
+		fields = append(fields, "title")
+	}
+	if a.Type != b.Type {
+		fields = append(fields, "type")
+	}
+	if a.Genre != b.Genre {
+		fields = append(fields, "genre")
+	}
+	if a.Status != b.Status {
+		fields = append(fields, fmt.Sprintf("status %s -> %s", a.Status, b.Status))
+	}
+	if a.Link != b.Link {
+		fields = append(fields, "link")
+	}
+	if strings.Join(a.Tags, ",") != strings.Join(b.Tags, ",") {
+		fields = append(fields, "tags")
+	}
+	if a.Author != b.Author {
+		fields = append(fields, "author")
+	}
+	if a.ISBN != b.ISBN {
+		fields = append(fields, "isbn")
+	}
+	if a.Rating != b.Rating {
+		fields = append(fields, "rating")
+	}
+	if a.AddedAt != b.AddedAt {
+		fields = append(fields, "added_at")
+	}
+	if a.Show != b.Show {
+		fields = append(fields, "show")
+	}
+	if a.Duration != b.Duration {
+		fields = append(fields, "duration")
+	}
+	if a.Published != b.Published {
+		fields = append(fields, "published")
+	}
+	if a.Enclosure != b.Enclosure {
+		fields = append(fields, "enclosure")
+	}
+	if len(fields) == 0 {
+		fields = append(fields, "other fields")
+	}
+	return fields
+}
+
+// Function to roll resources and playlists back to a backup after showing what would change.
+// With --yes it doesn't ask before restoring.
+func restoreBackup(reader *bufio.Reader, args []string) error {
+	var name string
+	confirmed := false
+	for _, arg := range args {
+		switch {
+		case arg == "--yes" || arg == "-y":
+			confirmed = true
+		case name == "" && !strings.HasPrefix(arg, "-"):
+			name = arg
+		default:
+			return usageErrorf("usage: restore <#|snapshot> [--yes] (see `backups`)")
+		}
+	}
+	if name == "" {
+		return usageErrorf("usage: restore <#|snapshot> [--yes] (see `backups`)")
+	}
+	backups, err := listBackups()
+	if err != nil {
+		return fmt.Errorf("reading backups: %w", err)
+	}
+	var target *backup
+	for i := range backups {
+		if backups[i].Name == name || strconv.Itoa(i+1) == name {
+			target = &backups[i]
+			break
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("%w: %s", errBackupNotFound, name)
+	}
+
+	snapshot, err := readBackupResources(*target)
+	if err != nil {
+		return fmt.Errorf("reading backup: %w", err)
+	}
+	snapshotPlaylists, err := readBackupPlaylists(*target)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading backup: %w", err)
+	}
+	resources, err := loadResources()
+	if err != nil {
+		return fmt.Errorf("loading resources: %w", err)
+	}
+	playlists, err := loadPlaylists()
+	if err != nil {
+		return fmt.Errorf("loading playlists: %w", err)
+	}
+
+	color.Cyan("Restoring %s would change the catalog like this:", target.Name)
+	diff := diffCatalogs(resources.List, snapshot.List)
+	printCatalogDiff(diff, 20)
+	samePlaylists := sameJSON(playlists.List, snapshotPlaylists.List)
+	if !samePlaylists {
+		fmt.Printf("Playlists: %d now, %d in the backup\n", len(playlists.List), len(snapshotPlaylists.List))
+	}
+	if diff.empty() && samePlaylists {
+		color.Green("The current data already matches this backup.")
+		return nil
+	}
+
+	if !confirmed {
+		fmt.Print("Restore this backup? (y/N): ")
+		answer, _ := reader.ReadString('\n')
+		if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+			color.Yellow("Restore cancelled.")
+			return nil
+		}
+	}
+	if err := backupBefore("restore"); err != nil {
+		return err
+	}
+
+	entry := journalEntry{Command: "restore", Description: fmt.Sprintf("restored backup %s", target.Name)}
+	entry.Resources = diffChanges(resources.List, diff)
+	if err := saveResources(snapshot); err != nil {
+		return fmt.Errorf("saving resources: %w", err)
+	}
+	if !samePlaylists {
+		entry.Playlists = playlistChanges(playlists.List, snapshotPlaylists.List)
+		if err := savePlaylists(snapshotPlaylists); err != nil {
+			return fmt.Errorf("saving playlists: %w", err)
+		}
+	}
+	recordOperation(entry)
+	color.Green("Restored backup %s.", target.Name)
+	return nil
+}
+
+// Function to turn a diff into journal changes so it can be undone
+func diffChanges(from []Resource, d catalogDiff) []resourceChange {
+	var changes []resourceChange
+	for i := range d.Changed {
+		p := &d.Changed[i]
+		changes = append(changes, resourceChange{ID: p.New.ID, Index: findResourceByID(from, p.Old.ID), Before: &p.Old, After: &p.New})
+	}
+	for i := range d.Removed {
+		r := &d.Removed[i]
+		changes = append(changes, resourceChange{ID: r.ID, Index: findResourceByID(from, r.ID), Before: r})
+	}
+	for i := range d.Added {
+		changes = append(changes, resourceChange{ID: d.Added[i].ID, Index: -1, After: &d.Added[i]})
+	}
+	return changes
+}
+
+// Function to list the playlist changes that turn one list into another
+func playlistChanges(from, to []Playlist) []playlistChange {
+	var changes []playlistChange
+	for i := range from {
+		j := findPlaylistByID(to, from[i].ID)
+		switch {
+		case j < 0:
+			changes = append(changes, playlistChange{ID: from[i].ID, Index: i, Before: &from[i]})
+		case !sameJSON(from[i], to[j]):
+			changes = append(changes, playlistChange{ID: from[i].ID, Index: i, Before: &from[i], After: &to[j]})
+		}
+	}
+	for j := range to {
+		if findPlaylistByID(from, to[j].ID) < 0 {
+			changes = append(changes, playlistChange{ID: to[j].ID, Index: -1, After: &to[j]})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,565 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/color"
+	"golang.org/x/text/unicode/norm"
+)
+
+func init() {
+	importers.register("bibtex", "<library.bib> [--genre 'AI ML'] [flags]",
+		"Import the entries of a BibTeX library", importBibTeX)
+	exporters.register("bibtex", "[file] [--query q]",
+		"Export resources as BibTeX, arXiv papers as @article and the rest as @misc", exportBibTeX)
+}
+
+// arXiv IDs in links: new style 2409.04109 and old style hep-th/9901001, with or without a version
+var arxivLinkPattern = regexp.MustCompile(`arxiv\.org/(?:abs|pdf|html)/([a-z-]+(?:\.[A-Z]{2})?/\d{7}|\d{4}\.\d{4,5})(?:v\d+)?`)
+
+// Function to get the arXiv ID from a link, "" if it isn't an arXiv link
+func arxivID(link string) string {
+	if m := arxivLinkPattern.FindStringSubmatch(link); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// Function to get the year an arXiv ID was submitted in, from its YYMM part
+func arxivYear(id string) string {
+	yymm := id
+	if _, number, ok := strings.Cut(id, "/"); ok {
+		yymm = number
+	}
+	if len(yymm) < 2 {
+		return ""
+	}
+	if yymm[:2] >= "91" { // arXiv started in 1991
+		return "19" + yymm[:2]
+	}
+	return "20" + yymm[:2]
+}
+
+func exportBibTeX(fs *flag.FlagSet, args []string) error {
+	query := fs.String("query", "", "only export the resources matching a query, e.g. 'genre:\"AI ML\"'")
+	path, err := parseExportArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	resources, err := runQuery(*query)
+	if err != nil {
+		return err
+	}
+	return writeExport(path, len(resources), func(w io.Writer) error {
+		return writeBibTeX(w, resources)
+	})
+}
+
+// Function to write resources as BibTeX entries keyed by their IDs. Papers with an arXiv
+// link become @article with the arXiv journal line Google Scholar uses, the rest @misc.
+func writeBibTeX(w io.Writer, resources []Resource) error {
+	for i, r := range resources {
+		type field struct{ name, value string }
+		var fields []field
+		add := func(name, value string) {
+			if value != "" {
+				fields = append(fields, field{name, value})
+			}
+		}
+
+		kind := "misc"
+		if author := strings.TrimSpace(r.Author); author != "..." {
+			add("author", bibtexEscape(bibtexAuthors(author)))
+		}
+		add("title", bibtexTitle(stripListNumber(r.Title)))
+		if id := arxivID(r.Link); id != "" {
+			kind = "article"
+			add("journal", "arXiv preprint arXiv:"+bibtexEscape(id))
+			add("year", arxivYear(id))
+			add("eprint", bibtexEscape(id))
+			add("archivePrefix", "arXiv")
+		}
+		add("isbn", r.ISBN)
+		add("url", r.Link)
+		add("keywords", bibtexEscape(strings.Join(r.Tags, ", ")))
+
+		var b strings.Builder
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "@%s{%s,\n", kind, bibtexKey(r.ID))
+		for k, f := range fields {
+			fmt.Fprintf(&b, "  %s = {%s}", f.name, f.value)
+			if k < len(fields)-1 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("}\n")
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to turn "Ashish Vaswani, Noam Shazeer et al." into the "and" list BibTeX
+// expects. A comma only separates authors when every part is a full name, so
+// "Dalio, Ray" is left alone.
+func bibtexAuthors(author string) string {
+	etAl := false
+	if trimmed := strings.TrimSuffix(author, " et al."); trimmed != author {
+		author, etAl = trimmed, true
+	}
+	names := strings.Split(author, ", ")
+	for _, name := range names {
+		if !strings.Contains(strings.TrimSpace(name), " ") {
+			names = []string{author}
+			break
+		}
+	}
+	if etAl {
+		names = append(names, "others")
+	}
+	return strings.Join(names, " and ")
+}
+
+// Function to make a citation key out of a resource ID, keeping only the characters BibTeX allows
+func bibtexKey(id string) string {
+	key := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_:.", r)) {
+			return r
+		}
+		return '-'
+	}, strings.TrimSpace(id))
+	if key == "" {
+		return "resource"
+	}
+	return key
+}
+
+// Function to escape the characters LaTeX treats specially
+func bibtexEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\textbackslash{}`)
+		case '&', '%', '$', '#', '_', '{', '}':
+			b.WriteString(`\` + string(r))
+		case '~':
+			b.WriteString(`\textasciitilde{}`)
+		case '^':
+			b.WriteString(`\textasciicircum{}`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Function to escape a title and brace the words with capitals inside them, like LLMs or
+// GPT-4, so bibliography styles that lowercase titles leave them alone
+func bibtexTitle(title string) string {
+	words := strings.Fields(title)
+	for i, word := range words {
+		escaped := bibtexEscape(word)
+		for k, r := range []rune(word) {
+			if k > 0 && unicode.IsUpper(r) {
+				escaped = "{" + escaped + "}"
+				break
+			}
+		}
+		words[i] = escaped
+	}
+	return strings.Join(words, " ")
+}
+
+// bibEntry is one entry of a BibTeX file, field names are lowercase.
+type bibEntry struct {
+	kind, key string
+	fields    map[string]string
+	line      int
+}
+
+// bibParser reads BibTeX the way BibTeX does: @string macros, # concatenation, braced
+// and quoted values. Comments and @preamble are skipped.
+type bibParser struct {
+	src    string
+	pos    int
+	macros map[string]string
+}
+
+var bibMonths = map[string]string{
+	"jan": "January", "feb": "February", "mar": "March", "apr": "April", "may": "May", "jun": "June",
+	"jul": "July", "aug": "August", "sep": "September", "oct": "October", "nov": "November", "dec": "December",
+}
+
+// Function to parse a BibTeX file. Broken entries are reported and skipped, the count is returned.
+func parseBibTeX(src string) ([]bibEntry, int) {
+	p := &bibParser{src: src, macros: make(map[string]string)}
+	for name, month := range bibMonths {
+		p.macros[name] = month
+	}
+	var entries []bibEntry
+	skipped := 0
+	for {
+		at := strings.IndexByte(p.src[p.pos:], '@')
+		if at < 0 {
+			return entries, skipped
+		}
+		p.pos += at
+		start := p.pos
+		entry, err := p.entry()
+		if err != nil {
+			color.Yellow("Skipping the entry on line %d: %v", p.lineAt(start), err)
+			skipped++
+			p.pos = start + 1
+			continue
+		}
+		if entry != nil {
+			entry.line = p.lineAt(start)
+			entries = append(entries, *entry)
+		}
+	}
+}
+
+func (p *bibParser) lineAt(pos int) int {
+	return strings.Count(p.src[:pos], "\n") + 1
+}
+
+func (p *bibParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// Function to read a name: an entry type, citation key part, field or macro name
+func (p *bibParser) name() string {
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(" \t\r\n{}()=,#\"@%", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *bibParser) expect(c byte) error {
+	p.skipSpace()
+	if p.pos >= len(p.src) || p.src[p.pos] != c {
+		return fmt.Errorf("expected '%c'", c)
+	}
+	p.pos++
+	return nil
+}
+
+// Function to read one @-block, returns nil for blocks that aren't entries
+func (p *bibParser) entry() (*bibEntry, error) {
+	p.pos++ // @
+	kind := strings.ToLower(p.name())
+	p.skipSpace()
+	if kind == "" || p.pos >= len(p.src) || (p.src[p.pos] != '{' && p.src[p.pos] != '(') {
+		return nil, nil // An @ in the text between entries, like in an email address
+	}
+	closing := byte('}')
+	if p.src[p.pos] == '(' {
+		closing = ')'
+	}
+
+	switch kind {
+	case "comment", "preamble":
+		_, err := p.braced()
+		return nil, err
+	case "string":
+		p.pos++
+		p.skipSpace()
+		name := strings.ToLower(p.name())
+		if err := p.expect('='); err != nil {
+			return nil, err
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		p.macros[name] = value
+		return nil, p.expect(closing)
+	}
+
+	p.pos++
+	p.skipSpace()
+	entry := &bibEntry{kind: kind, fields: make(map[string]string)}
+	keyStart := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] != ',' && p.src[p.pos] != closing {
+		p.pos++
+	}
+	entry.key = strings.TrimSpace(p.src[keyStart:p.pos])
+	for {
+		p.skipSpace()
+		for p.pos < len(p.src) && p.src[p.pos] == ',' {
+			p.pos++
+			p.skipSpace()
+		}
+		if p.pos >= len(p.src) {
+			return nil, fmt.Errorf("the entry %q isn't closed", entry.key)
+		}
+		if p.src[p.pos] == closing {
+			p.pos++
+			return entry, nil
+		}
+		field := strings.ToLower(p.name())
+		if field == "" {
+			return nil, fmt.Errorf("unexpected '%c' in %q", p.src[p.pos], entry.key)
+		}
+		if err := p.expect('='); err != nil {
+			return nil, fmt.Errorf("%v after %s in %q", err, field, entry.key)
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, fmt.Errorf("%v in the %s of %q", err, field, entry.key)
+		}
+		entry.fields[field] = value
+	}
+}
+
+// Function to read a field value: braced, quoted, a number or macro, joined with #
+func (p *bibParser) value() (string, error) {
+	var b strings.Builder
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return "", fmt.Errorf("missing value")
+		}
+		switch c := p.src[p.pos]; {
+		case c == '{':
+			part, err := p.braced()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(part)
+		case c == '"':
+			part, err := p.quoted()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(part)
+		default:
+			part := p.name()
+			if part == "" {
+				return "", fmt.Errorf("unexpected '%c'", c)
+			}
+			if macro, ok := p.macros[strings.ToLower(part)]; ok {
+				part = macro
+			}
+			b.WriteString(part)
+		}
+		p.skipSpace()
+		if p.pos >= len(p.src) || p.src[p.pos] != '#' {
+			return b.String(), nil
+		}
+		p.pos++
+	}
+}
+
+// Function to read {...} with nested braces, returns what's inside
+func (p *bibParser) braced() (string, error) {
+	open := p.src[p.pos]
+	closing := byte('}')
+	if open == '(' {
+		closing = ')'
+	}
+	start := p.pos + 1
+	depth := 0
+	for i := p.pos; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '\\':
+			i++ // \{ and \} don't count
+		case open:
+			depth++
+		case closing:
+			depth--
+			if depth == 0 {
+				p.pos = i + 1
+				return p.src[start:i], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unbalanced braces")
+}
+
+// Function to read "..." where quotes inside braces don't end the value
+func (p *bibParser) quoted() (string, error) {
+	start := p.pos + 1
+	depth := 0
+	for i := start; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '"':
+			if depth == 0 {
+				p.pos = i + 1
+				return p.src[start:i], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unclosed quote")
+}
+
+var (
+	// \"o, \"{o} and {\"o}, the accents BibTeX files use most
+	latexAccent = regexp.MustCompile(`\\(["'` + "`" + `^~=.])\s*\{?([A-Za-z])\}?`)
+	// Other commands like \emph or \textbf, their argument is kept
+	latexCommand     = regexp.MustCompile(`\\[A-Za-z]+\s*`)
+	latexAccentMarks = map[string]string{
+		`"`: "\u0308", `'`: "\u0301", "`": "\u0300", `^`: "\u0302", `~`: "\u0303", `=`: "\u0304", `.`: "\u0307",
+	}
+	// A backslash is held back until the commands are gone, or it would start one again
+	latexSymbols = strings.NewReplacer(`\&`, "&", `\%`, "%", `\$`, "$", `\#`, "#", `\_`, "_",
+		`\{`, "\x00", `\}`, "\x01", `\textbackslash{}`, "\x02", `\textasciitilde{}`, "~", `\textasciicircum{}`, "^",
+		`\ss{}`, "ß", `\o{}`, "ø", `\aa{}`, "å",
+		"---", "—", "--", "–", "``", "“", "''", "”", "~", " ")
+)
+
+// Function to turn a LaTeX value into plain text: accents become letters, escapes their
+// characters, other commands and grouping braces go away
+func latexToText(s string) string {
+	s = latexAccent.ReplaceAllStringFunc(s, func(m string) string {
+		parts := latexAccent.FindStringSubmatch(m)
+		return parts[2] + latexAccentMarks[parts[1]]
+	})
+	s = latexSymbols.Replace(s)
+	s = latexCommand.ReplaceAllString(s, "")
+	s = strings.NewReplacer("{", "", "}", "", "\x00", "{", "\x01", "}", "\x02", `\`).Replace(s)
+	return strings.Join(strings.Fields(norm.NFC.String(s)), " ")
+}
+
+var bibAuthorSeparator = regexp.MustCompile(`\s+and\s+`)
+
+// Function to turn "Vaswani, Ashish and Shazeer, Noam and others" into "Ashish Vaswani, Noam Shazeer et al."
+func bibAuthors(value string) string {
+	var names []string
+	etAl := false
+	for _, name := range bibAuthorSeparator.Split(latexToText(value), -1) {
+		name = strings.TrimSpace(name)
+		if strings.EqualFold(name, "others") {
+			etAl = true
+			continue
+		}
+		if last, first, ok := strings.Cut(name, ","); ok {
+			name = strings.TrimSpace(strings.TrimSpace(first) + " " + strings.TrimSpace(last))
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	authors := strings.Join(names, ", ")
+	if etAl {
+		authors += " et al."
+	}
+	return authors
+}
+
+// \url{...} or \href{...}{text}, how entries without a url field give their link in howpublished or note
+var latexURL = regexp.MustCompile(`\\(?:url|href)\s*\{([^{}]+)\}`)
+
+// Function to get the link out of a howpublished or note value, "" if it has none
+func bibURLIn(value string) string {
+	if m := latexURL.FindStringSubmatch(value); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
+		return strings.TrimRight(strings.Fields(value)[0], ".,;")
+	}
+	return ""
+}
+
+// Function to find the best link for an entry: its URL (or the one in howpublished or note),
+// the DOI or the arXiv eprint. arXiv links are written as the abstract page without a version,
+// like the scraper's.
+func bibLink(fields map[string]string) string {
+	link := strings.TrimSpace(fields["url"])
+	for _, field := range []string{"howpublished", "note"} {
+		if link == "" {
+			link = bibURLIn(fields[field])
+		}
+	}
+	if link == "" {
+		if doi := strings.TrimSpace(fields["doi"]); doi != "" {
+			link = "https://doi.org/" + strings.TrimPrefix(strings.TrimPrefix(doi, "https://doi.org/"), "doi:")
+		}
+	}
+	if id := arxivID(link); id != "" {
+		return "https://arxiv.org/abs/" + id
+	}
+	// archivePrefix in BibTeX, eprinttype in biblatex
+	eprint := strings.TrimSpace(fields["eprint"])
+	isArxiv := strings.EqualFold(fields["archiveprefix"], "arxiv") || strings.EqualFold(fields["eprinttype"], "arxiv")
+	if link == "" && eprint != "" && isArxiv {
+		return "https://arxiv.org/abs/" + strings.TrimPrefix(eprint, "arXiv:")
+	}
+	return link
+}
+
+func importBibTeX(fs *flag.FlagSet, args []string) error {
+	opts := addImportFlags(fs)
+	genre := fs.String("genre", "AI ML", "genre of the imported entries")
+	rest, err := parseExactArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(rest[0])
+	if err != nil {
+		return err
+	}
+
+	entries, skipped := parseBibTeX(string(data))
+	var resources []Resource
+	for _, e := range entries {
+		title := latexToText(e.fields["title"])
+		if title == "" {
+			color.Yellow("Skipping %s on line %d: no title.", e.key, e.line)
+			skipped++
+			continue
+		}
+		r := Resource{
+			Title:  title,
+			Author: bibAuthors(e.fields["author"]),
+			Genre:  *genre,
+			Type:   "article",
+			Link:   bibLink(e.fields),
+			ISBN:   cleanISBN(e.fields["isbn"]),
+			Tags:   []string{},
+		}
+		if r.Author == "" {
+			r.Author = bibAuthors(e.fields["editor"])
+		}
+		if e.kind == "book" {
+			r.Type = "book"
+		}
+		for _, keyword := range strings.FieldsFunc(latexToText(e.fields["keywords"]), func(c rune) bool { return c == ',' || c == ';' }) {
+			if keyword = strings.TrimSpace(keyword); keyword != "" && !containsFold(r.Tags, keyword) {
+				r.Tags = append(r.Tags, keyword)
+			}
+		}
+		resources = append(resources, r)
+	}
+	if len(resources) == 0 && skipped == 0 {
+		return fmt.Errorf("%s: no BibTeX entries found", rest[0])
+	}
+	return commitImport(stdin, importBatch{
+		command:     "import-bibtex",
+		source:      filepath.Base(rest[0]),
+		resources:   resources,
+		skippedRows: skipped,
+	}, opts)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestParseBibTeXValues(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"braced", `@misc{k, title = {Deep {Work}}}`, "Deep {Work}"},
+		{"quoted with a brace group", `@misc{k, title = "A {"}quote{"} inside"}`, `A {"}quote{"} inside`},
+		{"number", `@misc{k, title = 2024}`, "2024"},
+		{"macro", `@string{pub = "O'Reilly"} @misc{k, title = pub}`, "O'Reilly"},
+		{"macro names ignore case", `@STRING{Pub = {O'Reilly}} @misc{k, title = PUB}`, "O'Reilly"},
+		{"macro in parentheses", `@string(pub = "No Starch") @misc{k, title = pub}`, "No Starch"},
+		{"concatenation", `@string{pub = "O'Reilly"} @misc{k, title = pub # " Media" # { Inc.}}`, "O'Reilly Media Inc."},
+		{"macro built from a macro", `@string{a = "x"} @string{b = a # "y"} @misc{k, title = b # a}`, "xyx"},
+		{"month", `@misc{k, title = jan # "~1"}`, "January~1"},
+		{"unknown macro is kept", `@misc{k, title = draft}`, "draft"},
+		{"escaped braces", `@misc{k, title = {a \} b}}`, `a \} b`},
+		{"entry in parentheses", `@misc(k, title = {x (y)})`, "x (y)"},
+		{"comment skipped", `@comment{@string{pub = "x"}} @misc{k, title = pub}`, "pub"},
+	}
+	for _, tt := range tests {
+		entries, skipped := parseBibTeX(tt.src)
+		if skipped != 0 || len(entries) != 1 {
+			t.Errorf("%s: parsed %d entries and skipped %d, want 1 entry", tt.name, len(entries), skipped)
+			continue
+		}
+		if got := entries[0].fields["title"]; got != tt.want {
+			t.Errorf("%s: title is %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseBibTeXSkipsBrokenEntries(t *testing.T) {
+	src := "@misc{a, title = {one}}\n" +
+		"@misc{b, title = {unbalanced}\n" +
+		"@misc{c, title = \"open}\n" +
+		"mail me@example.com\n" +
+		"@book{e, title = {two}, author = undefined # }\n" +
+		"@book{f, title = {three},}\n"
+	entries, skipped := parseBibTeX(src)
+	var keys []string
+	for _, e := range entries {
+		keys = append(keys, e.key)
+	}
+	if got := fmt.Sprint(keys); got != "[a f]" || skipped == 0 {
+		t.Errorf("parsed %s and skipped %d, want [a f] and some skipped", got, skipped)
+	}
+	if len(entries) == 2 && entries[1].line != 6 {
+		t.Errorf("f is on line %d, want 6", entries[1].line)
+	}
+}
+
+func TestBibtexEscapeRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		"plain", "Rock & Roll", "100% sure", "$5 ideas", "#1 hit", "snake_case", "{braces}",
+		`C:\Users\me`, `\emph`, "a~b", "x^2", "naïve café", `all: \{&%$#_~^}`,
+	} {
+		escaped := bibtexEscape(s)
+		if got := latexToText(escaped); got != s {
+			t.Errorf("%q escapes to %q and reads back as %q", s, escaped, got)
+		}
+	}
+}
+
+func TestWriteBibTeXReadsBack(t *testing.T) {
+	resources := []Resource{
+		{ID: "tech001", Title: "GPT-4 & the 100% #1 Model_Card", Author: "Ada Lovelace, Alan Turing et al.",
+			Link: "https://arxiv.org/abs/2303.08774v2", Tags: []string{"ai", "c++"}},
+		{ID: "odd id/2", Title: `Paths like C:\tmp and ~home`, Author: "Dalio, Ray", Link: "https://example.com/?a=1&b=2"},
+	}
+	var buf bytes.Buffer
+	if err := writeBibTeX(&buf, resources); err != nil {
+		t.Fatal(err)
+	}
+	entries, skipped := parseBibTeX(buf.String())
+	if skipped != 0 || len(entries) != len(resources) {
+		t.Fatalf("read back %d entries and skipped %d from\n%s", len(entries), skipped, buf.String())
+	}
+	tests := []struct {
+		key, kind, title, author, link, keywords string
+	}{
+		{"tech001", "article", resources[0].Title, "Ada Lovelace, Alan Turing et al.", "https://arxiv.org/abs/2303.08774", "ai, c++"},
+		{"odd-id-2", "misc", resources[1].Title, "Ray Dalio", resources[1].Link, ""},
+	}
+	for i, tt := range tests {
+		e := entries[i]
+		if e.key != tt.key || e.kind != tt.kind || latexToText(e.fields["title"]) != tt.title ||
+			bibAuthors(e.fields["author"]) != tt.author || bibLink(e.fields) != tt.link || latexToText(e.fields["keywords"]) != tt.keywords {
+			t.Errorf("entry %d read back as %s %s %q, want %+v", i, e.kind, e.key, e.fields, tt)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/fatih/color"
+)
+
+func init() {
+	importers.register("bookmarks", "<bookmarks.html> [--folders tags|playlists|both|none] [flags]",
+		"Import links from a browser, Pocket or Raindrop bookmark export (Netscape HTML)", importBookmarks)
+}
+
+// bookmark is one link of a Netscape bookmark file, with the folders it sits in.
+type bookmark struct {
+	title, link string
+	addedAt     string
+	folders     []string // outermost first
+	tags        []string // from the TAGS attribute some exporters write
+}
+
+func importBookmarks(fs *flag.FlagSet, args []string) error {
+	opts := addImportFlags(fs)
+	folders := fs.String("folders", "tags", "what bookmark folders become: tags, playlists, both or none")
+	genre := fs.String("genre", "bookmarks", "genre of the imported links, bookmarks don't have one")
+	rest, err := parseExactArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	asTags, asPlaylists := false, false
+	switch strings.ToLower(*folders) {
+	case "tags":
+		asTags = true
+	case "playlists":
+		asPlaylists = true
+	case "both":
+		asTags, asPlaylists = true, true
+	case "none":
+	default:
+		return usageErrorf("--folders is tags, playlists, both or none, not %q", *folders)
+	}
+
+	f, err := os.Open(rest[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	bookmarks, skipped, err := readBookmarks(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", rest[0], err)
+	}
+	if len(bookmarks) == 0 && skipped == 0 {
+		return fmt.Errorf("%s: no bookmarks found, is it a bookmark export?", rest[0])
+	}
+
+	batch := importBatch{command: "import-bookmarks", source: filepath.Base(rest[0])}
+	if asPlaylists {
+		batch.playlists = make(map[string][]int)
+	}
+	batch.skippedRows = skipped
+	for n, b := range bookmarks {
+		r := Resource{
+			Title:   b.title,
+			Link:    b.link,
+			Genre:   *genre,
+			Type:    bookmarkType(b.link),
+			AddedAt: b.addedAt,
+			Tags:    append([]string{}, b.tags...),
+		}
+		if asTags {
+			for _, folder := range b.folders {
+				if tag := strings.ToLower(folder); !containsFold(r.Tags, tag) {
+					r.Tags = append(r.Tags, tag)
+				}
+			}
+		}
+		if asPlaylists && len(b.folders) > 0 {
+			// Nested folders make one playlist each, "Dev / Go"
+			name := strings.Join(b.folders, " / ")
+			batch.playlists[name] = append(batch.playlists[name], n)
+		}
+		batch.resources = append(batch.resources, r)
+	}
+	return commitImport(stdin, batch, opts)
+}
+
+// Folders browsers put everything in, they say nothing about the links.
+var rootBookmarkFolders = []string{"PERSONAL_TOOLBAR_FOLDER", "UNFILED_BOOKMARKS_FOLDER"}
+
+// Function to read the links of a Netscape bookmark file, returns how many were skipped.
+// Folders are <H3> headings followed by a <DL> with their contents.
+func readBookmarks(r io.Reader) ([]bookmark, int, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var bookmarks []bookmark
+	skipped := 0
+	doc.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		href := strings.TrimSpace(a.AttrOr("href", ""))
+		u, err := url.Parse(href)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			// place:, javascript: and browser-internal links
+			color.Yellow("Skipping %s: not a web link.", shorten(href, 60))
+			skipped++
+			return
+		}
+		b := bookmark{
+			title: strings.Join(strings.Fields(a.Text()), " "),
+			link:  href,
+		}
+		if b.title == "" {
+			b.title = href
+		}
+		// ADD_DATE in browser and Raindrop exports, time_added in Pocket's
+		for _, attr := range []string{"add_date", "time_added"} {
+			if value, ok := a.Attr(attr); ok {
+				b.addedAt = unixTimestamp(value)
+				break
+			}
+		}
+		for _, tag := range strings.Split(a.AttrOr("tags", ""), ",") {
+			if tag = strings.TrimSpace(tag); tag != "" && !containsFold(b.tags, tag) {
+				b.tags = append(b.tags, tag)
+			}
+		}
+		a.ParentsFiltered("dl").Each(func(_ int, dl *goquery.Selection) {
+			if name := bookmarkFolderName(dl); name != "" {
+				b.folders = append([]string{name}, b.folders...)
+			}
+		})
+		bookmarks = append(bookmarks, b)
+	})
+	return bookmarks, skipped, nil
+}
+
+// Function to find the name of the folder a <DL> holds, "" for the top level and the
+// browsers' own root folders. The heading is usually the previous sibling, but after a
+// folder description the list ends up inside the <DD> that follows the heading's <DT>.
+func bookmarkFolderName(dl *goquery.Selection) string {
+	heading := dl.PrevAllFiltered("h3").First()
+	if heading.Length() == 0 && dl.Parent().Is("dd") {
+		heading = dl.Parent().PrevAllFiltered("dt").First().ChildrenFiltered("h3")
+	}
+	if heading.Length() == 0 {
+		return ""
+	}
+	for _, attr := range rootBookmarkFolders {
+		if _, ok := heading.Attr(strings.ToLower(attr)); ok {
+			return ""
+		}
+	}
+	return strings.Join(strings.Fields(heading.Text()), " ")
+}
+
+// Function to turn a Unix timestamp into RFC 3339, some exporters write milliseconds
+// or microseconds. Returns "" if it can't be read.
+func unixTimestamp(value string) string {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n <= 0 {
+		return ""
+	}
+	for n > 1e11 { // Past the year 5000 in seconds, so it's finer than that
+		n /= 1000
+	}
+	return time.Unix(n, 0).UTC().Format(time.RFC3339)
+}
+
+// Function to guess whether a link is a whole website (just a domain) or an article on one
+func bookmarkType(link string) string {
+	u, err := url.Parse(link)
+	if err == nil && strings.Trim(u.Path, "/") == "" && u.RawQuery == "" {
+		return "website"
+	}
+	return "article"
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnixTimestamp(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"1704103200", "2024-01-01T10:00:00Z"},
+		{"1704103200123", "2024-01-01T10:00:00Z"},    // milliseconds
+		{"1704103200123456", "2024-01-01T10:00:00Z"}, // microseconds
+		{" 1704103200 ", "2024-01-01T10:00:00Z"},
+		{"86400", "1970-01-02T00:00:00Z"},
+		{"0", ""},
+		{"-5", ""},
+		{"", ""},
+		{"yesterday", ""},
+	}
+	for _, tt := range tests {
+		if got := unixTimestamp(tt.value); got != tt.want {
+			t.Errorf("unixTimestamp(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestReadBookmarksFolders(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want map[string][]string // link -> folders
+	}{
+		{"nested folders",
+			`<DL><p>
+			<DT><H3>Reading</H3>
+			<DL><p>
+				<DT><A HREF="https://example.com/a">A</A>
+				<DT><H3>Go</H3>
+				<DL><p>
+					<DT><A HREF="https://example.com/b">B</A>
+				</DL><p>
+				<DT><A HREF="https://example.com/c">C</A>
+			</DL><p>
+			<DT><A HREF="https://example.com/d">D</A>
+			</DL>`,
+			map[string][]string{"https://example.com/a": {"Reading"}, "https://example.com/b": {"Reading", "Go"},
+				"https://example.com/c": {"Reading"}, "https://example.com/d": nil}},
+		{"a description before the folder's list",
+			`<DL><p>
+			<DT><H3>Recipes</H3>
+			<DD>Things to cook
+			<DL><p>
+				<DT><A HREF="https://example.com/soup">Soup</A>
+				<DT><H3>Baking</H3>
+				<DD>Bread mostly
+				<DL><p>
+					<DT><A HREF="https://example.com/bread">Bread</A>
+				</DL><p>
+			</DL><p>
+			</DL>`,
+			map[string][]string{"https://example.com/soup": {"Recipes"}, "https://example.com/bread": {"Recipes", "Baking"}}},
+		{"the browsers' root folders are left out",
+			`<DL><p>
+			<DT><H3 PERSONAL_TOOLBAR_FOLDER="true">Bookmarks bar</H3>
+			<DL><p>
+				<DT><H3>News</H3>
+				<DL><p>
+					<DT><A HREF="https://example.com/news">News</A>
+				</DL><p>
+			</DL><p>
+			<DT><H3 UNFILED_BOOKMARKS_FOLDER="true">Other bookmarks</H3>
+			<DL><p>
+				<DT><A HREF="https://example.com/other">Other</A>
+			</DL><p>
+			</DL>`,
+			map[string][]string{"https://example.com/news": {"News"}, "https://example.com/other": nil}},
+	}
+	for _, tt := range tests {
+		bookmarks, skipped, err := readBookmarks(strings.NewReader(tt.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string][]string)
+		for _, b := range bookmarks {
+			got[b.link] = b.folders
+		}
+		if skipped != 0 || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: folders are %q (%d skipped), want %q", tt.name, got, skipped, tt.want)
+		}
+	}
+}
+
+func TestReadBookmarksAttributes(t *testing.T) {
+	html := `<DL><p>
+	<DT><A HREF="https://example.com/a" ADD_DATE="1704103200" TAGS="go, Go,tools">  Two
+	  words </A>
+	<DT><A HREF="https://example.com/b" time_added="1704103200123"></A>
+	<DT><A HREF="javascript:alert(1)">Bookmarklet</A>
+	<DT><A HREF="place:sort=8">Recent</A>
+	</DL>`
+	bookmarks, skipped, err := readBookmarks(strings.NewReader(html))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bookmark{
+		{title: "Two words", link: "https://example.com/a", addedAt: "2024-01-01T10:00:00Z", tags: []string{"go", "tools"}},
+		{title: "https://example.com/b", link: "https://example.com/b", addedAt: "2024-01-01T10:00:00Z"},
+	}
+	if skipped != 2 || !reflect.DeepEqual(bookmarks, want) {
+		t.Errorf("read %+v (%d skipped), want %+v and 2 skipped", bookmarks, skipped, want)
+	}
+}
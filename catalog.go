@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// Catalog is the session's copy of the resources and playlists. It is loaded from
+// the store on first use and kept in memory, with indexes for the lookups the
+// commands make. Changes are written to the store first and then applied here,
+// so the copy only goes back to disk on mutation.
+type Catalog struct {
+	loaded    bool
+	resources Resources
+	playlists Playlists
+
+	byID     map[string]int // lowercase ID -> position in resources.List
+	byGenre  map[string][]int
+	byTag    map[string][]int
+	byStatus map[string][]int
+	byType   map[string][]int
+
+	search *searchIndex // built by Search on first use, dropped on every change
+}
+
+// catalog is shared by every command of the session.
+var catalog = &Catalog{}
+
+// Fields the catalog keeps an index for, usable with Filter.
+var catalogIndexes = []string{"genre", "tag", "status", "type"}
+
+// Function to load the catalog from the store the first time it is needed
+func (c *Catalog) ensureLoaded() error {
+	if c.loaded {
+		return nil
+	}
+	// Missing files are an empty catalog, they are created on the first save
+	resources, err := store.LoadResources()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	playlists, err := store.LoadPlaylists()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	c.resources = resources
+	c.playlists = playlists
+	c.reindex()
+	c.loaded = true
+	return nil
+}
+
+// Function to drop the in-memory copy, the next lookup reads the store again.
+// Used after changes that bypass the catalog, like replaying the event log.
+func (c *Catalog) Invalidate() {
+	*c = Catalog{}
+}
+
+// Function to drop the copy when the store says it is out of date
+func (c *Catalog) checkConflict(err error) error {
+	if errors.Is(err, errConflict) {
+		c.Invalidate()
+	}
+	return err
+}
+
+// Function to rebuild every index from scratch
+func (c *Catalog) reindex() {
+	c.byID = make(map[string]int, len(c.resources.List))
+	c.byGenre = make(map[string][]int)
+	c.byTag = make(map[string][]int)
+	c.byStatus = make(map[string][]int)
+	c.byType = make(map[string][]int)
+	for i := range c.resources.List {
+		c.index(i)
+	}
+}
+
+// Function to add the resource at position i to the indexes
+func (c *Catalog) index(i int) {
+	r := c.resources.List[i]
+	c.search = nil
+	c.byID[strings.ToLower(r.ID)] = i
+	c.byGenre[strings.ToLower(r.Genre)] = append(c.byGenre[strings.ToLower(r.Genre)], i)
+	c.byStatus[strings.ToLower(r.Status)] = append(c.byStatus[strings.ToLower(r.Status)], i)
+	c.byType[strings.ToLower(r.Type)] = append(c.byType[strings.ToLower(r.Type)], i)
+	for _, key := range tagKeys(r) {
+		c.byTag[key] = append(c.byTag[key], i)
+	}
+}
+
+// Function to remove the resource at position i from the secondary indexes
+func (c *Catalog) unindex(i int) {
+	r := c.resources.List[i]
+	removePosition(c.byGenre, strings.ToLower(r.Genre), i)
+	removePosition(c.byStatus, strings.ToLower(r.Status), i)
+	removePosition(c.byType, strings.ToLower(r.Type), i)
+	for _, key := range tagKeys(r) {
+		removePosition(c.byTag, key, i)
+	}
+}
+
+// Function to get a resource's distinct tags as index keys
+func tagKeys(r Resource) []string {
+	var keys []string
+	seen := make(map[string]bool, len(r.Tags))
+	for _, tag := range r.Tags {
+		key := strings.ToLower(tag)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func removePosition(index map[string][]int, key string, i int) {
+	positions := index[key]
+	for k, p := range positions {
+		if p == i {
+			positions = append(positions[:k], positions[k+1:]...)
+			break
+		}
+	}
+	if len(positions) == 0 {
+		delete(index, key)
+	} else {
+		index[key] = positions
+	}
+}
+
+// Function to get every resource in catalog order. The slice is shared, don't modify it.
+func (c *Catalog) Resources() ([]Resource, error) {
+	if err := c.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	return c.resources.List, nil
+}
+
+// Function to find a resource by ID, the position is -1 if it isn't there
+func (c *Catalog) Lookup(id string) (Resource, int, error) {
+	if err := c.ensureLoaded(); err != nil {
+		return Resource{}, -1, err
+	}
+	i, ok := c.byID[strings.ToLower(id)]
+	if !ok {
+		return Resource{}, -1, nil
+	}
+	return c.resources.List[i], i, nil
+}
+
+// Function to get the resources whose genre, tag, status or type equals value, ignoring case
+func (c *Catalog) Filter(field, value string) ([]Resource, error) {
+	if err := c.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	var index map[string][]int
+	switch field {
+	case "genre":
+		index = c.byGenre
+	case "tag":
+		index = c.byTag
+	case "status":
+		index = c.byStatus
+	case "type":
+		index = c.byType
+	default:
+		return nil, errors.New("unknown filter criteria: " + field)
+	}
+	positions := index[strings.ToLower(value)]
+	found := make([]Resource, len(positions))
+	for k, i := range positions {
+		found[k] = c.resources.List[i]
+	}
+	return found, nil
+}
+
+// Function to add or replace a resource, returning its position before the change (-1 if it is new)
+func (c *Catalog) Put(resource Resource) (int, error) {
+	if err := c.ensureLoaded(); err != nil {
+		return -1, err
+	}
+	if err := store.PutResource(resource); err != nil {
+		return -1, c.checkConflict(err)
+	}
+	i, ok := c.byID[strings.ToLower(resource.ID)]
+	if !ok {
+		c.resources.List = append(c.resources.List, resource)
+		c.index(len(c.resources.List) - 1)
+		return -1, nil
+	}
+	c.unindex(i)
+	delete(c.byID, strings.ToLower(c.resources.List[i].ID))
+	c.resources.List[i] = resource
+	c.index(i)
+	return i, nil
+}
+
+// Function to delete a resource by ID
+func (c *Catalog) Delete(id string) error {
+	if err := c.ensureLoaded(); err != nil {
+		return err
+	}
+	if err := store.DeleteResource(id); err != nil {
+		return c.checkConflict(err)
+	}
+	if i, ok := c.byID[strings.ToLower(id)]; ok {
+		// A fresh slice: callers may still hold the one Resources handed out
+		list := make([]Resource, 0, len(c.resources.List)-1)
+		list = append(list, c.resources.List[:i]...)
+		c.resources.List = append(list, c.resources.List[i+1:]...)
+		// Everything after i moved down one place
+		c.reindex()
+	}
+	return nil
+}
+
+// Function to get a copy of every resource, for bulk changes that edit the list and save it back
+func (c *Catalog) LoadResources() (Resources, error) {
+	if err := c.ensureLoaded(); err != nil {
+		return Resources{}, err
+	}
+	resources := c.resources
+	resources.List = append([]Resource(nil), c.resources.List...)
+	return resources, nil
+}
+
+// Function to replace the whole catalog
+func (c *Catalog) SaveResources(resources Resources) error {
+	if err := store.SaveResources(resources); err != nil {
+		return c.checkConflict(err)
+	}
+	if c.loaded {
+		c.resources.List = append([]Resource(nil), resources.List...)
+		c.reindex()
+	}
+	return nil
+}
+
+// Function to get every playlist. The slice is shared, don't modify it.
+func (c *Catalog) Playlists() ([]Playlist, error) {
+	if err := c.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	return c.playlists.List, nil
+}
+
+// Function to add or replace a playlist
+func (c *Catalog) PutPlaylist(playlist Playlist) error {
+	if err := c.ensureLoaded(); err != nil {
+		return err
+	}
+	if err := store.PutPlaylist(playlist); err != nil {
+		return c.checkConflict(err)
+	}
+	playlist = copyPlaylist(playlist)
+	if i := findPlaylistByID(c.playlists.List, playlist.ID); i >= 0 {
+		c.playlists.List[i] = playlist
+	} else {
+		c.playlists.List = append(c.playlists.List, playlist)
+	}
+	return nil
+}
+
+// Function to get a copy of every playlist, for bulk changes
+func (c *Catalog) LoadPlaylists() (Playlists, error) {
+	if err := c.ensureLoaded(); err != nil {
+		return Playlists{}, err
+	}
+	playlists := c.playlists
+	playlists.List = make([]Playlist, len(c.playlists.List))
+	for i, p := range c.playlists.List {
+		playlists.List[i] = copyPlaylist(p)
+	}
+	return playlists, nil
+}
+
+// Function to replace every playlist
+func (c *Catalog) SavePlaylists(playlists Playlists) error {
+	if err := store.SavePlaylists(playlists); err != nil {
+		return c.checkConflict(err)
+	}
+	if c.loaded {
+		c.playlists.List = make([]Playlist, len(playlists.List))
+		for i, p := range playlists.List {
+			c.playlists.List[i] = copyPlaylist(p)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// nopStore accepts every change and keeps nothing, so the benchmarks measure the catalog
+// and not the disk.
+type nopStore struct{ resources Resources }
+
+func (s nopStore) LoadResources() (Resources, error) { return s.resources, nil }
+func (s nopStore) SaveResources(Resources) error     { return nil }
+func (s nopStore) PutResource(Resource) error        { return nil }
+func (s nopStore) DeleteResource(string) error       { return nil }
+func (s nopStore) LoadPlaylists() (Playlists, error) { return Playlists{}, nil }
+func (s nopStore) SavePlaylists(Playlists) error     { return nil }
+func (s nopStore) PutPlaylist(Playlist) error        { return nil }
+func (s nopStore) DeletePlaylist(string) error       { return nil }
+func (s nopStore) Close() error                      { return nil }
+
+var (
+	benchGenres   = []string{"tech", "science", "history", "fiction", "music"}
+	benchStatuses = []string{"unviewed", "viewed", "in-progress"}
+	benchTypes    = []string{"article", "book", "video", "podcast"}
+)
+
+// Function to generate a catalog of n resources spread over a few genres, statuses and types, with 57 tags
+func generateResources(n int) []Resource {
+	list := make([]Resource, n)
+	for i := range list {
+		genre := benchGenres[i%len(benchGenres)]
+		list[i] = Resource{
+			ID:     fmt.Sprintf("%s%05d", genre, i),
+			Title:  fmt.Sprintf("Resource number %d", i),
+			Type:   benchTypes[i%len(benchTypes)],
+			Genre:  genre,
+			Status: benchStatuses[i%len(benchStatuses)],
+			Link:   fmt.Sprintf("https://example.com/%d", i),
+			Tags:   []string{fmt.Sprintf("tag%d", i%50), fmt.Sprintf("Group%d", i%7)},
+		}
+	}
+	return list
+}
+
+// Function to load a fresh catalog of n generated resources behind a nopStore
+func useGeneratedCatalog(tb testing.TB, n int) []Resource {
+	tb.Helper()
+	list := generateResources(n)
+	previous, previousCatalog := store, catalog
+	store = nopStore{resources: Resources{Version: resourcesSchemaVersion, List: append([]Resource(nil), list...)}}
+	catalog = &Catalog{}
+	tb.Cleanup(func() { store, catalog = previous, previousCatalog })
+	if err := catalog.ensureLoaded(); err != nil {
+		tb.Fatal(err)
+	}
+	return list
+}
+
+// Function to filter the way the commands did before the catalog, one pass over every resource
+func filterLinear(resources []Resource, field, value string) []Resource {
+	var found []Resource
+	for _, r := range resources {
+		switch field {
+		case "genre":
+			if strings.EqualFold(r.Genre, value) {
+				found = append(found, r)
+			}
+		case "tag":
+			for _, tag := range r.Tags {
+				if strings.EqualFold(tag, value) {
+					found = append(found, r)
+					break
+				}
+			}
+		case "status":
+			if strings.EqualFold(r.Status, value) {
+				found = append(found, r)
+			}
+		}
+	}
+	return found
+}
+
+const benchCatalogSize = 50000
+
+func BenchmarkLookup(b *testing.B) {
+	list := useGeneratedCatalog(b, benchCatalogSize)
+	id := list[len(list)*3/4].ID
+	b.Run("catalog", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, at, _ := catalog.Lookup(id); at < 0 {
+				b.Fatal("not found")
+			}
+		}
+	})
+	b.Run("linear scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if findResourceByID(list, id) < 0 {
+				b.Fatal("not found")
+			}
+		}
+	})
+}
+
+func BenchmarkFilter(b *testing.B) {
+	list := useGeneratedCatalog(b, benchCatalogSize)
+	for field, value := range map[string]string{"genre": "history", "tag": "TAG17", "status": "viewed"} {
+		b.Run(field+"/catalog", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if found, _ := catalog.Filter(field, value); len(found) == 0 {
+					b.Fatal("nothing found")
+				}
+			}
+		})
+		b.Run(field+"/linear scan", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if len(filterLinear(list, field, value)) == 0 {
+					b.Fatal("nothing found")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPut(b *testing.B) {
+	list := useGeneratedCatalog(b, benchCatalogSize)
+	changed := list[len(list)*3/4]
+	changed.Status = "viewed"
+	b.Run("catalog", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := catalog.Put(changed); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("linear scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if at := findResourceByID(list, changed.ID); at >= 0 {
+				list[at] = changed
+			} else {
+				list = append(list, changed)
+			}
+		}
+	})
+}
+
+func TestCatalogLookupFilterPut(t *testing.T) {
+	useGeneratedCatalog(t, 100)
+
+	r, at, err := catalog.Lookup("HISTORY00002")
+	if err != nil || at != 2 || r.ID != "history00002" {
+		t.Fatalf("Lookup = %q at %d, %v; want history00002 at 2", r.ID, at, err)
+	}
+	if _, at, _ := catalog.Lookup("missing"); at != -1 {
+		t.Fatalf("Lookup(missing) at %d, want -1", at)
+	}
+
+	list, _ := catalog.Resources()
+	for field, value := range map[string]string{"genre": "SCIENCE", "tag": "TAG3", "status": "viewed"} {
+		found, err := catalog.Filter(field, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filterLinear(list, field, value); len(found) != len(want) || len(found) == 0 {
+			t.Errorf("Filter(%s, %s) found %d, the linear scan %d", field, value, len(found), len(want))
+		}
+	}
+
+	r.Status = "viewed"
+	r.Tags = []string{"moved"}
+	if before, err := catalog.Put(r); err != nil || before != 2 {
+		t.Fatalf("Put = %d, %v; want 2", before, err)
+	}
+	if found, _ := catalog.Filter("tag", "moved"); len(found) != 1 || found[0].ID != r.ID {
+		t.Errorf("Filter(tag, moved) = %v after Put", found)
+	}
+	if found, _ := catalog.Filter("tag", "tag2"); len(found) != 1 {
+		t.Errorf("Filter(tag, tag2) found %d after Put, want the one left", len(found))
+	}
+}
+
+func TestCatalogDeleteLeavesHandedOutSliceAlone(t *testing.T) {
+	useGeneratedCatalog(t, 10)
+	list, _ := catalog.Resources()
+	before := append([]Resource(nil), list...)
+
+	if err := catalog.Delete(before[3].ID); err != nil {
+		t.Fatal(err)
+	}
+	for i := range before {
+		if list[i].ID != before[i].ID {
+			t.Fatalf("position %d of the earlier slice changed from %s to %s", i, before[i].ID, list[i].ID)
+		}
+	}
+	after, _ := catalog.Resources()
+	if len(after) != 9 || after[3].ID != before[4].ID {
+		t.Fatalf("after Delete the catalog has %d resources, position 3 is %s", len(after), after[3].ID)
+	}
+	if _, at, _ := catalog.Lookup(before[9].ID); at != 8 {
+		t.Errorf("Lookup(%s) at %d after Delete, want 8", before[9].ID, at)
+	}
+}
+
+// testSession is one outgo process on the shared data directory: its own store and catalog.
+type testSession struct {
+	store   Store
+	catalog *Catalog
+}
+
+// Function to make a session's store and catalog the ones the commands use
+func (s testSession) use() {
+	store, catalog = s.store, s.catalog
+}
+
+func TestCatalogRefusesStaleSaveAfterAnotherSessionWrote(t *testing.T) {
+	for _, backend := range []string{storeEvents, storeJSON} {
+		t.Run(backend, func(t *testing.T) {
+			useTempDataDir(t)
+			*storeBackend = backend
+			if err := setupDataDir(); err != nil {
+				t.Fatal(err)
+			}
+			var sessions []testSession
+			open := func() testSession {
+				s, err := openStore(backend)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sessions = append(sessions, testSession{s, &Catalog{}})
+				return sessions[len(sessions)-1]
+			}
+			t.Cleanup(func() {
+				for _, s := range sessions {
+					s.store.Close()
+				}
+				store = nil
+			})
+			a, b := open(), open()
+
+			a.use()
+			if _, err := catalog.Resources(); err != nil {
+				t.Fatal(err)
+			}
+			b.use()
+			mustRun(t, "add", "--id", "zzz999", "--title", "Added by the other session")
+			a.use()
+			mustRun(t, "mark", "tech001", "--status", "viewed")
+
+			// The undo is a bulk save of a catalog that has never seen zzz999
+			if err := runCommand("undo", nil); !errors.Is(err, errConflict) {
+				t.Fatalf("undo after another session wrote = %v, want a conflict", err)
+			}
+			mustRun(t, "undo")
+
+			check := open()
+			check.use()
+			if _, at, _ := catalog.Lookup("zzz999"); at < 0 {
+				t.Error("zzz999 was lost")
+			}
+			if r, _, _ := catalog.Lookup("tech001"); r.Status == "viewed" {
+				t.Error("the mark of tech001 wasn't undone")
+			}
+		})
+	}
+}
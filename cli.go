@@ -0,0 +1,716 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// Exit codes of `outgo <command>`, so scripts can tell failures apart.
+const (
+	exitOK          = 0
+	exitFailure     = 1 // anything not listed below, e.g. an unreadable file
+	exitUsage       = 2 // unknown command, bad flags or arguments, invalid query
+	exitNotFound    = 3 // no such resource, playlist or backup, or nothing to undo/redo
+	exitConflict    = 4 // the data was changed by another outgo session, run the command again
+	exitInvalidData = 5 // the catalog has malformed entries, see `check`
+)
+
+// usageError is a command called with the wrong arguments.
+type usageError struct{ err error }
+
+func (e usageError) Error() string { return e.err.Error() }
+func (e usageError) Unwrap() error { return e.err }
+
+func usageErrorf(format string, args ...interface{}) error {
+	return usageError{fmt.Errorf(format, args...)}
+}
+
+// Function to pick the exit code for a command's error
+func exitCode(err error) int {
+	var usage usageError
+	var parseErr *ParseError
+	var catErr *catalogError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usage), errors.As(err, &parseErr):
+		return exitUsage
+	case errors.Is(err, errResourceNotFound), errors.Is(err, errPlaylistNotFound), errors.Is(err, errBackupNotFound),
+		errors.Is(err, errNothingToUndo), errors.Is(err, errNothingToRedo), errors.Is(err, errSourceNotFound):
+		return exitNotFound
+	case errors.Is(err, errConflict):
+		return exitConflict
+	case errors.As(err, &catErr), errors.Is(err, errInvalidCatalog):
+		return exitInvalidData
+	default:
+		return exitFailure
+	}
+}
+
+// Function to print a command's error, used by the REPL and the subcommands
+func reportError(err error) {
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		fmt.Fprintln(color.Error, color.RedString("Invalid query: %v", parseErr))
+		return
+	}
+	fmt.Fprintln(color.Error, color.RedString("Error: %v", err))
+}
+
+// cliCommand is a REPL command that can also be run as `outgo <command> [args] [flags]`.
+// run defines the command's flags on fs and parses args with parseArgs.
+type cliCommand struct {
+	args    string
+	summary string
+	run     func(fs *flag.FlagSet, args []string) error
+}
+
+var cliCommands = map[string]cliCommand{
+	"add":                  {"--id <id> --title <title> [flags]", "Add a resource, or replace the one with the same ID", cliAdd},
+	"list":                 {"[query] [flags]", "List the resources, or the ones matching a query", cliList},
+	"filter":               {"[query] [flags]", "Same as list", cliList},
+	"search":               {"<words> [flags]", "Search titles, authors, tags and genres, best matches first", cliSearch},
+	"delete":               {"<id>", "Delete a resource", cliDelete},
+	"mark":                 {"<id> --status <status>", "Change a resource's status", cliMark},
+	"random-resource":      {"[query] [flags]", "Pick a random resource, optionally one matching a query", cliRandom},
+	"fetch-updates":        {"[--source <name>] [--dry-run] [--yes]", "Sync with every enabled source: add new resources, update changed ones", cliFetchUpdates},
+	"episodes":             {"<show-id> [--unlistened] [--json]", "List a podcast's episodes and how many are listened to", cliEpisodes},
+	"subscribe":            {"<feed-url> [--name <name>] [--genre <genre>] [--tags a,b]", "Follow an RSS or Atom feed: add it as a source and bring in its entries", cliSubscribe},
+	"sources":              {"<list|add|remove|enable|disable> [args]", "Manage the sheets, CSV files and feeds fetch-updates reads", cliSources},
+	"create-playlist":      {"<name> [id...] [--query <query>]", "Create a playlist", cliCreatePlaylist},
+	"list-playlists":       {"[--format <format>]", "List the playlists", cliListPlaylists},
+	"view-playlist":        {"<id> [flags]", "Show a playlist's resources", cliViewPlaylist},
+	"add-to-playlist":      {"<playlist name> <id>", "Add a resource to a playlist", cliAddToPlaylist},
+	"remove-from-playlist": {"<playlist name> <id>", "Remove a resource from a playlist", cliRemoveFromPlaylist},
+	"undo":                 {"", "Undo the last change", noArgs(undoOperation)},
+	"redo":                 {"", "Redo the last undone change", noArgs(redoOperation)},
+	"history":              {"", "Show the changes that can be undone", noArgs(showHistory)},
+	"events":               {"[count]", "Show the latest entries of the event log", passArgs(showEvents)},
+	"compact":              {"", "Write fresh snapshots from the event log", noArgs(compactEvents)},
+	"rebuild":              {"--as-of <time> [--apply]", "Show or restore the state at a past time", passArgs(rebuildAsOf)},
+	"backups":              {"", "List the automatic backups", noArgs(showBackups)},
+	"restore":              {"<#|snapshot> [--yes]", "Roll back to a backup", passArgs(func(args []string) error { return restoreBackup(stdin, args) })},
+	"check":                {"", "Validate resources.json and list malformed entries", noArgs(checkCatalog)},
+	"migrate":              {"[--dry-run]", "Upgrade the data files to the current format", passArgs(migrateFiles)},
+	"import":               {"<format> <file> [flags]", "Import resources from a file, run `outgo import -h` for the formats", importers.run},
+	"export":               {"<format> [file] [flags]", "Export the catalog for another tool, run `outgo export -h` for the formats", exporters.run},
+}
+
+// formatRegistry holds the formats of a command that reads or writes other tools' files,
+// run as `outgo <command> <format> [args] [flags]`. Formats register from their file's init.
+type formatRegistry struct {
+	command string // "import" or "export"
+	args    string // what follows the format in the usage line
+	formats map[string]cliCommand
+}
+
+func newFormatRegistry(command, args string) *formatRegistry {
+	return &formatRegistry{command: command, args: args, formats: map[string]cliCommand{}}
+}
+
+// Function to make a format available to the registry's command
+func (r *formatRegistry) register(name, args, summary string, run func(fs *flag.FlagSet, args []string) error) {
+	r.formats[name] = cliCommand{args: args, summary: summary, run: run}
+}
+
+func (r *formatRegistry) names() []string {
+	var names []string
+	for name := range r.formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Function to run `<command> <format> [args] [flags]` with the format's flags
+func (r *formatRegistry) run(fs *flag.FlagSet, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+			r.printFormats()
+			return flag.ErrHelp
+		}
+		return usageErrorf("name a format to %s: %s", r.command, strings.Join(r.names(), ", "))
+	}
+	format, ok := r.formats[strings.ToLower(args[0])]
+	if !ok {
+		return usageErrorf("can't %s %q, use one of %s", r.command, args[0], strings.Join(r.names(), ", "))
+	}
+	name := r.command + " " + strings.ToLower(args[0])
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: outgo %s %s\n%s\n", name, format.args, format.summary)
+		fs.PrintDefaults()
+	}
+	return format.run(fs, args[1:])
+}
+
+func (r *formatRegistry) printFormats() {
+	fmt.Printf("Usage: outgo %s <format> %s\n", r.command, r.args)
+	for _, name := range r.names() {
+		fmt.Printf("  %-12s %s\n", name, r.formats[name].summary)
+	}
+}
+
+// Function to run `outgo <command> [args]` and return the exit code
+func runCLI(args []string) int {
+	name, args := args[0], args[1:]
+	switch name {
+	case "help", "-h", "--help":
+		printCLIHelp(os.Stdout)
+		return exitOK
+	case "filter-fields", "filter-playlist-fields":
+		reportError(usageErrorf("%s only changes the interactive session, use --fields with list instead", name))
+		return exitUsage
+	}
+
+	err := runCommand(name, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if store != nil {
+		if cerr := store.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		reportError(err)
+		var usage usageError
+		if errors.As(err, &usage) {
+			fmt.Fprintf(os.Stderr, "Run `outgo %s -h` for its flags.\n", name)
+		}
+	}
+	return exitCode(err)
+}
+
+// Function to run one of cliCommands with its flags, also used by the REPL for commands
+// that take flags. It returns flag.ErrHelp after showing the command's usage for -h.
+func runCommand(name string, args []string) error {
+	cmd, ok := cliCommands[name]
+	if !ok {
+		return usageErrorf("unknown command %q, run `outgo help` for the list", name)
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	// The global flags work after the command too, e.g. `outgo list --data-dir ~/books`
+	flag.VisitAll(func(f *flag.Flag) { fs.Var(f.Value, f.Name, f.Usage) })
+	// The flag package calls Usage on every parse error, parseArgs only shows it for -h
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: outgo %s %s\n%s\n", name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	return cmd.run(fs, args)
+}
+
+// Function to parse a command's flags and open the data directory.
+// Flags may come before, between or after the positional arguments; everything after "--" is positional.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				fs.SetOutput(os.Stdout)
+				fs.Usage()
+				return nil, err
+			}
+			return nil, usageError{err}
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	return positional, openSession()
+}
+
+// Function to wrap a command that takes no arguments
+func noArgs(run func() error) func(*flag.FlagSet, []string) error {
+	return func(fs *flag.FlagSet, args []string) error {
+		rest, err := parseArgs(fs, args)
+		if err != nil {
+			return err
+		}
+		if len(rest) > 0 {
+			return usageErrorf("unexpected argument %q", rest[0])
+		}
+		return run()
+	}
+}
+
+// Function to wrap a command that reads its own arguments, the global flags are still taken out first
+func passArgs(run func(args []string) error) func(*flag.FlagSet, []string) error {
+	return func(fs *flag.FlagSet, args []string) error {
+		// Unknown flags are left for the command to check
+		var own, global []string
+		for i := 0; i < len(args); i++ {
+			name := strings.SplitN(strings.TrimLeft(args[i], "-"), "=", 2)[0]
+			if name == "h" || name == "help" {
+				global = append(global, args[i])
+				continue
+			}
+			if !strings.HasPrefix(args[i], "-") || flag.Lookup(name) == nil {
+				own = append(own, args[i])
+				continue
+			}
+			global = append(global, args[i])
+			if _, isBool := flag.Lookup(name).Value.(interface{ IsBoolFlag() bool }); !isBool && !strings.Contains(args[i], "=") && i+1 < len(args) {
+				i++
+				global = append(global, args[i])
+			}
+		}
+		if _, err := parseArgs(fs, global); err != nil {
+			return err
+		}
+		return run(own)
+	}
+}
+
+// Function to print the subcommands
+func printCLIHelp(w io.Writer) {
+	fmt.Fprintln(w, "Usage: outgo [global flags] [command] [args] [flags]")
+	fmt.Fprintln(w, "Without a command outgo starts the interactive prompt.")
+	fmt.Fprintln(w, "\nCommands:")
+	var names []string
+	for name := range cliCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-22s %s\n", name, cliCommands[name].summary)
+	}
+	fmt.Fprintln(w, "\nGlobal flags:")
+	flag.CommandLine.SetOutput(w)
+	flag.PrintDefaults()
+	fmt.Fprintln(w, "\nRun `outgo <command> -h` for a command's flags.")
+	fmt.Fprintf(w, "\nExit codes: %d ok, %d failure, %d usage, %d not found, %d conflict, %d invalid data\n",
+		exitOK, exitFailure, exitUsage, exitNotFound, exitConflict, exitInvalidData)
+}
+
+// Function to print a value as indented JSON
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// Function to show only the given comma-separated resource fields, "all" shows every field
+func setVisibleFields(list string) error {
+	if strings.EqualFold(strings.TrimSpace(list), "all") {
+		for _, field := range resourceFieldOrder {
+			resourceFields[field] = true
+		}
+		return nil
+	}
+	visible := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, field := range resourceFieldOrder {
+			if strings.EqualFold(field, name) {
+				visible[field], found = true, true
+			}
+		}
+		if !found {
+			return usageErrorf("unknown field %q, use %s", name, strings.Join(resourceFieldOrder, ", "))
+		}
+	}
+	for _, field := range resourceFieldOrder {
+		resourceFields[field] = visible[field]
+	}
+	return nil
+}
+
+// resourceOutput holds the flags shared by the commands that print resources.
+type resourceOutput struct {
+	format *string
+	json   *bool
+	fields *string
+	sort   *string
+}
+
+func addOutputFlags(fs *flag.FlagSet) resourceOutput {
+	return resourceOutput{
+		format: fs.String("format", formatTable, "output format: "+strings.Join(outputFormats, ", ")),
+		json:   fs.Bool("json", false, "same as --format json"),
+		fields: fs.String("fields", "", "comma-separated columns to show, e.g. id,title,status, or all"),
+		sort:   fs.String("sort", "", "sort keys, e.g. title,-author"),
+	}
+}
+
+// Function to get the format asked for with --format or --json
+func (o resourceOutput) outputFormat() (string, error) {
+	if *o.json {
+		return formatJSON, nil
+	}
+	format, err := parseFormat(*o.format)
+	if err != nil {
+		return "", usageError{err}
+	}
+	return format, nil
+}
+
+// Function to print resources in the chosen format, sorted by --sort
+func (o resourceOutput) print(resources []Resource) error {
+	return o.printDecorated(resources, nil)
+}
+
+// Function to print resources like print, with decorate coloring the table cells (see resourceCell)
+func (o resourceOutput) printDecorated(resources []Resource, decorate func(field, value string) (string, bool)) error {
+	format, err := o.outputFormat()
+	if err != nil {
+		return err
+	}
+	if *o.sort != "" {
+		spec, err := parseSortSpec(*o.sort)
+		if err != nil {
+			return usageError{err}
+		}
+		resources = sortResources(resources, spec)
+	}
+	if *o.fields != "" {
+		if err := setVisibleFields(*o.fields); err != nil {
+			return err
+		}
+	}
+	if format != formatTable {
+		return writeResources(os.Stdout, format, resources)
+	}
+	if len(resources) == 0 {
+		color.Yellow("No resources found.")
+		return nil
+	}
+	renderResourceTable(resources, decorate)
+	return nil
+}
+
+// Fields list and filter have a flag for, e.g. --genre finance.
+var listFilterFlags = []string{"genre", "tag", "status", "type", "author"}
+
+func cliList(fs *flag.FlagSet, args []string) error {
+	out := addOutputFlags(fs)
+	filters := make(map[string]*string)
+	for _, field := range listFilterFlags {
+		filters[field] = fs.String(field, "", "only resources with this "+field)
+	}
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	// The flags are shorthands for field:value terms ANDed to the query
+	var q queryNode
+	if query := strings.Join(rest, " "); query != "" {
+		if q, err = parseQuery(query); err != nil {
+			return err
+		}
+	}
+	for _, field := range listFilterFlags {
+		if v := *filters[field]; v != "" {
+			if q == nil {
+				q = fieldNode{field, v}
+			} else {
+				q = andNode{q, fieldNode{field, v}}
+			}
+		}
+	}
+	var resources []Resource
+	if q == nil {
+		resources, err = catalog.Resources()
+	} else {
+		resources, err = catalog.Query(q)
+	}
+	if err != nil {
+		return err
+	}
+	return out.print(resources)
+}
+
+func cliSearch(fs *flag.FlagSet, args []string) error {
+	out := addOutputFlags(fs)
+	limit := fs.Int("limit", 0, "show at most this many results")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	query := strings.Join(rest, " ")
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return usageErrorf("nothing to search for, try more specific words")
+	}
+	hits, err := catalog.Search(query)
+	if err != nil {
+		return err
+	}
+	if *limit > 0 && len(hits) > *limit {
+		hits = hits[:*limit]
+	}
+	return out.printDecorated(hits, highlightSearchFields(terms))
+}
+
+func cliRandom(fs *flag.FlagSet, args []string) error {
+	asJSON := fs.Bool("json", false, "print the resource as JSON")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	resources, err := runQuery(strings.Join(rest, " "))
+	if err != nil {
+		return err
+	}
+	if len(resources) == 0 {
+		return fmt.Errorf("%w: nothing matches", errResourceNotFound)
+	}
+	r := resources[rand.Intn(len(resources))]
+	if *asJSON {
+		return printJSON(r)
+	}
+	color.Green("Random Resource: %s (ID: %s)", r.Title, r.ID)
+	return nil
+}
+
+func cliAdd(fs *flag.FlagSet, args []string) error {
+	var r Resource
+	fs.StringVar(&r.ID, "id", "", "resource ID, e.g. prog001 (required)")
+	fs.StringVar(&r.Title, "title", "", "title (required)")
+	fs.StringVar(&r.Type, "type", "", "book, video, podcast, website or course")
+	fs.StringVar(&r.Genre, "genre", "", "genre")
+	fs.StringVar(&r.Status, "status", "unread", "unread, viewed, in-progress or not-started")
+	fs.StringVar(&r.Link, "link", "", "link")
+	fs.StringVar(&r.Author, "author", "", "author")
+	tags := fs.String("tags", "", "comma-separated tags")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usageErrorf("unexpected argument %q", rest[0])
+	}
+	if r.ID == "" || r.Title == "" {
+		return usageErrorf("--id and --title are required")
+	}
+	r.Tags = []string{}
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			r.Tags = append(r.Tags, tag)
+		}
+	}
+
+	replaced, err := putResource(r)
+	if err != nil {
+		return err
+	}
+	if replaced {
+		color.Green("Replaced resource %s", r.ID)
+	} else {
+		color.Green("Added resource %s", r.ID)
+	}
+	return nil
+}
+
+// Function to take exactly n positional arguments
+func parseExactArgs(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != n {
+		return nil, usageErrorf("expected %d argument(s), got %d", n, len(rest))
+	}
+	return rest, nil
+}
+
+// Function to add the closest IDs to a resource-not-found error
+func withSuggestions(err error, id string) error {
+	if !errors.Is(err, errResourceNotFound) {
+		return err
+	}
+	candidates, serr := catalog.Suggest(id, 3)
+	if serr != nil || len(candidates) == 0 {
+		return err
+	}
+	var ids []string
+	for _, c := range candidates {
+		ids = append(ids, c.ID)
+	}
+	return fmt.Errorf("%w (did you mean %s?)", err, strings.Join(ids, ", "))
+}
+
+func cliDelete(fs *flag.FlagSet, args []string) error {
+	rest, err := parseExactArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	r, err := removeResource(rest[0])
+	if err != nil {
+		return withSuggestions(err, rest[0])
+	}
+	color.Green("Deleted resource: %s", r.ID)
+	return nil
+}
+
+func cliMark(fs *flag.FlagSet, args []string) error {
+	status := fs.String("status", "", "new status: unread, viewed, in-progress or not-started (required)")
+	rest, err := parseExactArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *status == "" {
+		return usageErrorf("--status is required")
+	}
+	before, err := setResourceStatus(rest[0], *status)
+	if err != nil {
+		return withSuggestions(err, rest[0])
+	}
+	color.Green("Updated status of resource: %s to %s (was %s)", before.ID, *status, before.Status)
+	return nil
+}
+
+func cliFetchUpdates(fs *flag.FlagSet, args []string) error {
+	var opts syncOptions
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "only show what would change")
+	fs.BoolVar(&opts.yes, "yes", false, "apply every change without asking")
+	only := fs.String("source", "", "only fetch this source, even if it is disabled")
+	if _, err := parseExactArgs(fs, args, 0); err != nil {
+		return err
+	}
+	return fetchUpdates(stdin, httpClient, *only, opts)
+}
+
+func cliCreatePlaylist(fs *flag.FlagSet, args []string) error {
+	query := fs.String("query", "", "also add every resource matching this query")
+	asJSON := fs.Bool("json", false, "print the new playlist as JSON")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return usageErrorf("a playlist needs a name")
+	}
+	name := rest[0]
+
+	var ids []string
+	if *query != "" {
+		matches, err := runQuery(*query)
+		if err != nil {
+			return err
+		}
+		for _, r := range matches {
+			ids = append(ids, r.ID)
+		}
+	}
+	for _, id := range rest[1:] {
+		r, i, err := catalog.Lookup(id)
+		if err != nil {
+			return err
+		}
+		if i < 0 {
+			return withSuggestions(fmt.Errorf("%w: %s", errResourceNotFound, id), id)
+		}
+		ids = append(ids, r.ID)
+	}
+
+	playlist, err := newPlaylist(name, ids)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(playlist)
+	}
+	color.Green("Playlist '%s' created successfully with ID: %s !", name, playlist.ID)
+	return nil
+}
+
+func cliListPlaylists(fs *flag.FlagSet, args []string) error {
+	out := resourceOutput{
+		format: fs.String("format", formatTable, "output format: "+strings.Join(outputFormats, ", ")),
+		json:   fs.Bool("json", false, "same as --format json"),
+	}
+	if _, err := parseExactArgs(fs, args, 0); err != nil {
+		return err
+	}
+	format, err := out.outputFormat()
+	if err != nil {
+		return err
+	}
+	playlists, err := catalog.Playlists()
+	if err != nil {
+		return err
+	}
+	if format != formatTable {
+		return writePlaylists(os.Stdout, format, playlists)
+	}
+	if len(playlists) == 0 {
+		color.Yellow("No playlists found.")
+		return nil
+	}
+	renderPlaylistTable(playlists)
+	return nil
+}
+
+func cliViewPlaylist(fs *flag.FlagSet, args []string) error {
+	out := addOutputFlags(fs)
+	rest, err := parseExactArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	playlists, err := catalog.Playlists()
+	if err != nil {
+		return err
+	}
+	i := findPlaylistByID(playlists, rest[0])
+	if i < 0 {
+		return fmt.Errorf("%w: %s", errPlaylistNotFound, rest[0])
+	}
+	resources, err := loadResources()
+	if err != nil {
+		return err
+	}
+	found, missing := resolvePlaylist(playlists[i], resources)
+	if format, _ := out.outputFormat(); format == formatTable {
+		color.Cyan("Playlist: %s", playlists[i].Name)
+	}
+	for _, id := range missing {
+		fmt.Fprintln(color.Error, color.YellowString("Resource %s is no longer in the catalog.", id))
+	}
+	return out.print(found)
+}
+
+func cliAddToPlaylist(fs *flag.FlagSet, args []string) error {
+	rest, err := parseExactArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	playlist, err := addToPlaylist(rest[0], rest[1])
+	if err != nil {
+		return withSuggestions(err, rest[1])
+	}
+	color.Green("Added resource %s to playlist '%s'", rest[1], playlist.Name)
+	return nil
+}
+
+func cliRemoveFromPlaylist(fs *flag.FlagSet, args []string) error {
+	rest, err := parseExactArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	playlist, err := removeFromPlaylist(rest[0], rest[1])
+	if err != nil {
+		return err
+	}
+	color.Green("Removed resource %s from playlist '%s'", rest[1], playlist.Name)
+	return nil
+}
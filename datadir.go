@@ -0,0 +1,112 @@
+package main
+
+import (
+	_ "embed"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// defaultCatalog is the resources.json shipped with outgo, used to seed a new data directory.
+//
+//go:embed resources.json
+var defaultCatalog []byte
+
+var dataDirFlag = flag.String("data-dir", "", "directory holding outgo's data files (overrides $OUTGO_HOME)")
+
+// dataDir is the directory all data files live in, set once at startup by setupDataDir.
+var dataDir string
+
+// Function to get the full path of a data file
+func dataPath(name string) string {
+	return filepath.Join(dataDir, name)
+}
+
+// Function to pick the data directory.
+// Order: --data-dir, $OUTGO_HOME, $XDG_DATA_HOME/outgo, then the platform default.
+func resolveDataDir() (string, error) {
+	if *dataDirFlag != "" {
+		return *dataDirFlag, nil
+	}
+	if home := os.Getenv("OUTGO_HOME"); home != "" {
+		return home, nil
+	}
+	// The XDG spec says relative paths must be ignored
+	if xdg := os.Getenv("XDG_DATA_HOME"); xdg != "" && filepath.IsAbs(xdg) {
+		return filepath.Join(xdg, "outgo"), nil
+	}
+	if runtime.GOOS == "windows" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "outgo"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "outgo"), nil
+}
+
+// Function to resolve the data directory and seed it on first run
+func setupDataDir() error {
+	dir, err := resolveDataDir()
+	if err != nil {
+		return fmt.Errorf("error finding data directory: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	dataDir = dir
+
+	// The event store can run from its log alone, the snapshot only comes with a compact
+	for _, name := range []string{resourcesFile, eventsFile, eventsArchiveFile} {
+		if _, err := os.Stat(dataPath(name)); err == nil {
+			return nil
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return seedDataDir()
+}
+
+// Function to fill a new data directory.
+// Files from an old setup in the working directory are copied over so nobody loses their progress,
+// otherwise the catalog embedded in the binary is used.
+func seedDataDir() error {
+	catalog := defaultCatalog
+	playlists := []byte(fmt.Sprintf("{\n  \"version\": %d,\n  \"playlists\": []\n}", playlistsSchemaVersion))
+
+	var copied []string
+	local, err := ioutil.ReadFile(resourcesFile)
+	if err == nil {
+		catalog = local
+		copied = append(copied, resourcesFile)
+	}
+	if err := writeFileAtomic(dataPath(resourcesFile), catalog, 0644); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dataPath(playlistsFile)); os.IsNotExist(err) {
+		if p, err := ioutil.ReadFile(playlistsFile); err == nil && local != nil {
+			playlists = p
+			copied = append(copied, playlistsFile)
+		}
+		if err := writeFileAtomic(dataPath(playlistsFile), playlists, 0644); err != nil {
+			return err
+		}
+	}
+
+	if len(copied) > 0 {
+		color.Yellow("Copied %s from the current directory to %s", strings.Join(copied, " and "), dataDir)
+	} else {
+		color.Yellow("Created a new catalog in %s", dataDir)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetupDataDirLeavesAnEventLogAlone(t *testing.T) {
+	for _, name := range []string{eventsFile, eventsArchiveFile} {
+		useTempDataDir(t)
+		log := filepath.Join(*dataDirFlag, name)
+		if err := os.WriteFile(log, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := setupDataDir(); err != nil {
+			t.Fatal(err)
+		}
+		for _, seeded := range []string{resourcesFile, playlistsFile} {
+			if _, err := os.Stat(dataPath(seeded)); !os.IsNotExist(err) {
+				t.Errorf("with only %s the data directory was seeded with %s", name, seeded)
+			}
+		}
+	}
+}
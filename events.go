@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Function to get the event store, the error tells the user when another backend is in use
+func requireEventStore() (*eventStore, error) {
+	s, ok := store.(*eventStore)
+	if !ok {
+		return nil, usageErrorf("this command needs the event log, start outgo with -store %s", storeEvents)
+	}
+	return s, nil
+}
+
+// Function to print the most recent events of the log (default 20)
+func showEvents(args []string) error {
+	s, err := requireEventStore()
+	if err != nil {
+		return err
+	}
+	limit := 20
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return usageErrorf("usage: events [count]")
+		}
+		limit = n
+	}
+
+	archived, err := readEvents(s.archivePath)
+	if err != nil {
+		return fmt.Errorf("reading events: %w", err)
+	}
+	live, err := readEvents(s.logPath)
+	if err != nil {
+		return fmt.Errorf("reading events: %w", err)
+	}
+	events := append(archived, live...)
+	if len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	for _, e := range events {
+		fmt.Printf("%6d  %s  %-18s %s\n", e.Seq, e.Time, e.Type, describeEvent(e))
+	}
+	color.Cyan("%d event(s) in the archive, %d in the live log.", len(archived), len(live))
+	return nil
+}
+
+// Function to summarize what an event changed
+func describeEvent(e event) string {
+	switch e.Type {
+	case eventResourcePut:
+		return fmt.Sprintf("%s (%s, %s)", e.Resource.ID, e.Resource.Title, e.Resource.Status)
+	case eventPlaylistPut:
+		return fmt.Sprintf("%s (%s, %d resources)", e.Playlist.ID, e.Playlist.Name, len(e.Playlist.ResourceIDs))
+	case eventResourcesReplace:
+		return fmt.Sprintf("%d resources", len(e.Resources))
+	case eventPlaylistsReplace:
+		return fmt.Sprintf("%d playlists", len(e.Playlists))
+	default:
+		return e.ID
+	}
+}
+
+// Function to fold the live log into fresh snapshots
+func compactEvents() error {
+	s, err := requireEventStore()
+	if err != nil {
+		return err
+	}
+	if err := s.Compact(); err != nil {
+		return fmt.Errorf("compacting the event log: %w", err)
+	}
+	color.Green("Snapshots written up to event %d, the live log was moved to %s.", s.lastSeq, eventsArchiveFile)
+	return nil
+}
+
+// Function to parse a point in time given on the command line
+func parseTimestamp(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			if layout == "2006-01-02" {
+				// A bare date means the state at the end of that day
+				t = t.Add(24*time.Hour - time.Nanosecond)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("can't read %q as a time, use e.g. 2024-10-01 or 2024-10-01T15:04", value)
+}
+
+// Function to show, and with --apply restore, the state as of a past timestamp.
+// Restoring appends events like any other change, so the log keeps the full history.
+func rebuildAsOf(args []string) error {
+	s, err := requireEventStore()
+	if err != nil {
+		return err
+	}
+	var when string
+	apply := false
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--apply":
+			apply = true
+		case args[i] == "--as-of" && i+1 < len(args):
+			i++
+			when = args[i]
+		case strings.HasPrefix(args[i], "--as-of="):
+			when = strings.TrimPrefix(args[i], "--as-of=")
+		default:
+			return usageErrorf("usage: rebuild --as-of <time> [--apply]")
+		}
+	}
+	if when == "" {
+		return usageErrorf("usage: rebuild --as-of <time> [--apply]")
+	}
+	at, err := parseTimestamp(when)
+	if err != nil {
+		return usageError{err}
+	}
+
+	past, pastPlaylists, err := s.stateAt(at)
+	if err != nil {
+		return fmt.Errorf("replaying the event log: %w", err)
+	}
+	current, currentPlaylists, err := s.load()
+	if err != nil {
+		return fmt.Errorf("loading the current state: %w", err)
+	}
+
+	resourceEvents := diffResourceEvents(current.List, past.List)
+	playlistEvents := diffPlaylistEvents(currentPlaylists.List, pastPlaylists.List)
+	color.Cyan("State as of %s: %d resources, %d playlists (now %d resources, %d playlists).",
+		at.Format(time.RFC3339), len(past.List), len(pastPlaylists.List), len(current.List), len(currentPlaylists.List))
+	fmt.Printf("Going back needs %d resource change(s) and %d playlist change(s).\n", len(resourceEvents), len(playlistEvents))
+	if !apply {
+		color.Yellow("Nothing was changed, add --apply to restore this state.")
+		return nil
+	}
+
+	if err := backupBefore("rebuild"); err != nil {
+		return err
+	}
+	err = s.record(func(Resources, Playlists) ([]event, error) {
+		return append(resourceEvents, playlistEvents...), nil
+	})
+	// The events went straight to the log, so the session's catalog is out of date either way
+	catalog.Invalidate()
+	if err != nil {
+		return fmt.Errorf("restoring: %w", err)
+	}
+	color.Green("Restored the state as of %s.", at.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+)
+
+// exporters holds every format `export` can write, `export <name> [file] [flags]`.
+var exporters = newFormatRegistry("export", "[file] [flags]")
+
+// Function to parse an exporter's flags and its optional file argument, "" or "-" means stdout
+func parseExportArgs(fs *flag.FlagSet, args []string) (string, error) {
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return "", err
+	}
+	if len(rest) > 1 {
+		return "", usageErrorf("expected at most 1 argument, got %d", len(rest))
+	}
+	if len(rest) == 0 {
+		return "", nil
+	}
+	return rest[0], nil
+}
+
+// Function to write an export to a file, or to stdout when path is "" or "-"
+func writeExport(path string, count int, write func(w io.Writer) error) error {
+	if path == "" || path == "-" {
+		return write(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	color.Green("Exported %d resource(s) to %s.", count, path)
+	return nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// feedItem is one entry of an RSS or Atom feed.
+type feedItem struct {
+	Title      string
+	Link       string
+	GUID       string // the item's guid or Atom id, the link if it has neither
+	Author     string
+	Published  time.Time // zero if the feed doesn't say
+	Categories []string
+}
+
+// feed is a parsed RSS 2.0, RSS 1.0 or Atom document.
+type feed struct {
+	Title string
+	Items []feedItem
+}
+
+// The parts of the three formats we read. RSS 2.0 keeps its items in <channel>,
+// RSS 1.0 next to it and Atom has <entry> at the top.
+type feedDocument struct {
+	XMLName xml.Name
+	Title   string      `xml:"title"`
+	Channel *rssChannel `xml:"channel"`
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssChannel struct {
+	Title string    `xml:"title"`
+	Items []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title      string   `xml:"title"`
+	Links      []string `xml:"link"`
+	GUID       string   `xml:"guid"`
+	About      string   `xml:"about,attr"` // RSS 1.0
+	Author     string   `xml:"author"`
+	Creator    string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	PubDate    string   `xml:"pubDate"`
+	Date       string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Categories []string `xml:"category"`
+}
+
+type atomEntry struct {
+	Title string `xml:"title"`
+	ID    string `xml:"id"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Authors []struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Published  string `xml:"published"`
+	Updated    string `xml:"updated"`
+	Categories []struct {
+		Term  string `xml:"term,attr"`
+		Label string `xml:"label,attr"`
+	} `xml:"category"`
+}
+
+// The date layouts feeds use in practice, RFC 1123 in RSS and RFC 3339 in Atom.
+var feedDateLayouts = []string{
+	time.RFC1123Z, time.RFC1123, time.RFC3339, time.RFC3339Nano,
+	"Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", "2 Jan 2006 15:04:05 -0700",
+	"2006-01-02T15:04:05", "2006-01-02",
+}
+
+func parseFeedDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Function to clean up an RSS author, which is often "jo@example.com (Jo Smith)"
+func feedAuthor(author string) string {
+	author = strings.TrimSpace(author)
+	if open := strings.Index(author, "("); open > 0 && strings.HasSuffix(author, ")") {
+		return strings.TrimSpace(author[open+1 : len(author)-1])
+	}
+	return author
+}
+
+// Function to read an RSS or Atom feed
+func parseFeed(r io.Reader) (feed, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+	var doc feedDocument
+	if err := decoder.Decode(&doc); err != nil {
+		return feed{}, fmt.Errorf("reading the feed: %v", err)
+	}
+
+	var f feed
+	switch strings.ToLower(doc.XMLName.Local) {
+	case "rss", "rdf":
+		items := doc.Items
+		if doc.Channel != nil {
+			f.Title = doc.Channel.Title
+			items = append(doc.Channel.Items, items...)
+		}
+		for _, it := range items {
+			item := feedItem{
+				Title:      strings.TrimSpace(it.Title),
+				GUID:       strings.TrimSpace(it.GUID),
+				Author:     feedAuthor(it.Author),
+				Published:  parseFeedDate(it.PubDate),
+				Categories: it.Categories,
+			}
+			for _, link := range it.Links {
+				if link = strings.TrimSpace(link); link != "" {
+					item.Link = link
+					break
+				}
+			}
+			if item.Link == "" {
+				item.Link = it.About
+			}
+			if item.Author == "" {
+				item.Author = strings.TrimSpace(it.Creator)
+			}
+			if item.Published.IsZero() {
+				item.Published = parseFeedDate(it.Date)
+			}
+			f.Items = append(f.Items, item)
+		}
+	case "feed":
+		f.Title = strings.TrimSpace(doc.Title)
+		for _, e := range doc.Entries {
+			item := feedItem{
+				Title:     strings.TrimSpace(e.Title),
+				GUID:      strings.TrimSpace(e.ID),
+				Published: parseFeedDate(e.Published),
+			}
+			if item.Published.IsZero() {
+				item.Published = parseFeedDate(e.Updated)
+			}
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					item.Link = strings.TrimSpace(l.Href)
+					break
+				}
+			}
+			var authors []string
+			for _, a := range e.Authors {
+				if name := strings.TrimSpace(a.Name); name != "" {
+					authors = append(authors, name)
+				}
+			}
+			item.Author = strings.Join(authors, ", ")
+			for _, c := range e.Categories {
+				if c.Label != "" {
+					item.Categories = append(item.Categories, c.Label)
+				} else {
+					item.Categories = append(item.Categories, c.Term)
+				}
+			}
+			f.Items = append(f.Items, item)
+		}
+	default:
+		return feed{}, fmt.Errorf("<%s> isn't an RSS or Atom feed", doc.XMLName.Local)
+	}
+	for i := range f.Items {
+		if f.Items[i].GUID == "" {
+			f.Items[i].GUID = f.Items[i].Link
+		}
+	}
+	return f, nil
+}
+
+// feedState is what a feed source remembers between fetches, so the server can answer
+// "not modified" and only entries newer than the last one seen are looked at.
+type feedState struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	LastGUID     string `json:"last_guid,omitempty"` // the newest entry at the last fetch
+	CheckedAt    string `json:"checked_at,omitempty"`
+}
+
+// Function to sort a feed's items newest first. Feeds nearly always list them that way
+// already, so if any item has no date the feed's own order is kept as it is.
+func (f feed) newestFirst() []feedItem {
+	items := append([]feedItem{}, f.Items...)
+	for _, item := range items {
+		if item.Published.IsZero() {
+			return items
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Published.After(items[j].Published)
+	})
+	return items
+}
+
+// Function to pick the items that came after the one with the GUID lastSeen, oldest first
+// so they get their IDs in the order they were published. If the feed no longer has that
+// item, all of them are new as far as we can tell.
+func (f feed) itemsSince(lastSeen string) []feedItem {
+	items := f.newestFirst()
+	for i, item := range items {
+		if lastSeen != "" && item.GUID == lastSeen {
+			items = items[:i]
+			break
+		}
+	}
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items
+}
+
+// Function to turn feed items into articles, with the categories as tags, and the GUID of
+// the item each article came from
+func feedResources(items []feedItem) (resources []Resource, guids []string) {
+	for _, item := range items {
+		if item.Title == "" && item.Link == "" {
+			continue
+		}
+		r := Resource{Title: item.Title, Link: item.Link, Author: item.Author, Type: "article", Tags: []string{}}
+		if r.Title == "" {
+			r.Title = item.Link
+		}
+		for _, category := range item.Categories {
+			if tag := strings.ToLower(strings.TrimSpace(category)); tag != "" && !containsFold(r.Tags, tag) {
+				r.Tags = append(r.Tags, tag)
+			}
+		}
+		resources = append(resources, r)
+		guids = append(guids, item.GUID)
+	}
+	return resources, guids
+}
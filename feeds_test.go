@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewestFirst(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name  string
+		items []feedItem
+		want  string
+	}{
+		{"dated, out of order", []feedItem{{GUID: "b", Published: day(2)}, {GUID: "c", Published: day(3)}, {GUID: "a", Published: day(1)}}, "cba"},
+		{"same date keeps feed order", []feedItem{{GUID: "x", Published: day(1)}, {GUID: "y", Published: day(1)}}, "xy"},
+		{"one undated keeps feed order", []feedItem{{GUID: "a", Published: day(1)}, {GUID: "u"}, {GUID: "c", Published: day(3)}}, "auc"},
+		{"none dated", []feedItem{{GUID: "p"}, {GUID: "q"}}, "pq"},
+	}
+	for _, tt := range tests {
+		var got strings.Builder
+		for _, item := range (feed{Items: tt.items}).newestFirst() {
+			got.WriteString(item.GUID)
+		}
+		if got.String() != tt.want {
+			t.Errorf("%s: newestFirst = %s, want %s", tt.name, got.String(), tt.want)
+		}
+	}
+}
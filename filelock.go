@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// errConflict is returned when a data file was changed by another outgo
+// session after this session loaded it.
+var errConflict = errors.New("modified by another outgo session since it was loaded")
+
+// Function to write a file so readers only ever see the old or the new contents.
+// The data goes to a temp file in the same directory which is then renamed over the target.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := ioutil.TempFile(dir, "."+name+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	// Clean up the temp file if anything below fails; after the rename this is a no-op.
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// Function to run fn while holding an advisory lock on path.
+// The lock lives in a separate "<path>.lock" file so the data file itself can be replaced.
+func withFileLock(path string, fn func() error) error {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("error locking %s: %v", path, err)
+	}
+	defer unlockFile(f)
+	return fn()
+}
+
+// jsonFile is a JSON data file that remembers what it last read or wrote,
+// so a save on top of data changed by someone else is refused.
+// Files written by older versions are upgraded with the migration chain on read.
+// decode, when set, replaces json.Unmarshal; it gets both the bytes on disk and the migrated bytes.
+type jsonFile struct {
+	path    string
+	listKey string
+	chain   []migration
+	decode  func(original, migrated []byte, v interface{}) error
+	seen    bool
+	digest  [sha256.Size]byte
+}
+
+// Function to read, migrate and decode the file, remembering its contents for conflict checks
+func (f *jsonFile) read(v interface{}) error {
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	f.seen = true
+	f.digest = sha256.Sum256(data)
+	migrated := data
+	if f.chain != nil {
+		migrated, _, err = migrateData(data, f.listKey, f.chain)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filepath.Base(f.path), describeJSONError(data, err))
+		}
+	}
+	if f.decode != nil {
+		return f.decode(data, migrated, v)
+	}
+	if err := json.Unmarshal(migrated, v); err != nil {
+		return fmt.Errorf("%s: %v", filepath.Base(f.path), describeJSONError(migrated, err))
+	}
+	return nil
+}
+
+// Function to encode and atomically write the file. The caller must hold the file lock.
+func (f *jsonFile) write(v interface{}) error {
+	if f.seen {
+		current, err := ioutil.ReadFile(f.path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil && sha256.Sum256(current) != f.digest {
+			return fmt.Errorf("%s was %w; run the command again to work on the latest data", filepath.Base(f.path), errConflict)
+		}
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(f.path, data, 0644); err != nil {
+		return err
+	}
+	f.seen = true
+	f.digest = sha256.Sum256(data)
+	return nil
+}
+
+// Function to encode and write the file under its lock
+func (f *jsonFile) save(v interface{}) error {
+	return withFileLock(f.path, func() error {
+		return f.write(v)
+	})
+}
+
+// Function to re-read the file, let fn change it and write it back, all under one lock.
+// The change is made on the latest data, but if another session wrote the file since this
+// one read it, the old digest is kept: what this session has in memory still misses that
+// write, so its next save must be refused.
+func (f *jsonFile) update(v interface{}, fn func() error) error {
+	return withFileLock(f.path, func() error {
+		seen, digest := f.seen, f.digest
+		if err := f.read(v); err != nil {
+			return err
+		}
+		foreign := seen && f.digest != digest
+		if err := fn(); err != nil {
+			return err
+		}
+		if err := f.write(v); err != nil {
+			return err
+		}
+		if foreign {
+			f.digest = digest
+		}
+		return nil
+	})
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Output formats of the listing commands. Everything but table prints every
+// match at once, without paging, so it can be piped into other tools.
+const (
+	formatTable    = "table"
+	formatJSON     = "json"
+	formatJSONL    = "jsonl"
+	formatCSV      = "csv"
+	formatTSV      = "tsv"
+	formatMarkdown = "markdown"
+	formatYAML     = "yaml"
+)
+
+var outputFormats = []string{formatTable, formatJSON, formatJSONL, formatCSV, formatTSV, formatMarkdown, formatYAML}
+
+// Function to check a --format value, "md" and "yml" are accepted too
+func parseFormat(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "md":
+		return formatMarkdown, nil
+	case "yml":
+		return formatYAML, nil
+	}
+	for _, f := range outputFormats {
+		if value == f {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q, use one of %s", value, strings.Join(outputFormats, ", "))
+}
+
+// Function to take `--format x` (or `--format=x`) out of a command's arguments, table if it isn't there
+func extractFormatFlag(args []string) ([]string, string, error) {
+	rest, value, found, err := extractValueFlag(args, "--format", "--format json")
+	if err != nil || !found {
+		return rest, formatTable, err
+	}
+	format, err := parseFormat(value)
+	return rest, format, err
+}
+
+// outputColumn is one column of the output, key names it in json, yaml, csv and tsv,
+// title in the table and markdown headers.
+type outputColumn struct {
+	key, title string
+}
+
+// The keys resource fields are written with, the same as in resources.json.
+var resourceFieldKeys = map[string]string{
+	"ID": "id", "Title": "title", "Author": "author", "Genre": "genre", "Type": "type", "Status": "status", "Tags": "tags",
+	"ISBN": "isbn", "Rating": "rating", "Added": "added_at", "Show": "show", "Duration": "duration", "Published": "published",
+}
+
+// Function to get the columns for the visible resource fields
+func resourceColumns() []outputColumn {
+	var columns []outputColumn
+	for _, field := range resourceFieldOrder {
+		if resourceFields[field] {
+			columns = append(columns, outputColumn{resourceFieldKeys[field], field})
+		}
+	}
+	return columns
+}
+
+// Function to get a resource's values for the visible fields, a string, int or []string each
+func resourceValues(r Resource) []interface{} {
+	var values []interface{}
+	for _, field := range resourceFieldOrder {
+		if !resourceFields[field] {
+			continue
+		}
+		switch field {
+		case "ID":
+			values = append(values, r.ID)
+		case "Title":
+			values = append(values, r.Title)
+		case "Author":
+			values = append(values, r.Author)
+		case "Genre":
+			values = append(values, r.Genre)
+		case "Type":
+			values = append(values, r.Type)
+		case "Status":
+			values = append(values, r.Status)
+		case "Tags":
+			values = append(values, append([]string{}, r.Tags...))
+		case "ISBN":
+			values = append(values, r.ISBN)
+		case "Rating":
+			values = append(values, r.Rating)
+		case "Added":
+			values = append(values, r.AddedAt)
+		case "Show":
+			values = append(values, r.Show)
+		case "Duration":
+			values = append(values, r.Duration)
+		case "Published":
+			values = append(values, r.Published)
+		}
+	}
+	return values
+}
+
+// The order playlist columns are shown in.
+var playlistFieldOrder = []string{"ID", "Name", "Resources"}
+
+var playlistFieldKeys = map[string]string{"ID": "id", "Name": "name", "Resources": "resource_ids"}
+
+func playlistColumns() []outputColumn {
+	var columns []outputColumn
+	for _, field := range playlistFieldOrder {
+		if playlistFields[field] {
+			columns = append(columns, outputColumn{playlistFieldKeys[field], field})
+		}
+	}
+	return columns
+}
+
+func playlistValues(p Playlist) []interface{} {
+	var values []interface{}
+	for _, field := range playlistFieldOrder {
+		if !playlistFields[field] {
+			continue
+		}
+		switch field {
+		case "ID":
+			values = append(values, p.ID)
+		case "Name":
+			values = append(values, p.Name)
+		case "Resources":
+			values = append(values, append([]string{}, p.ResourceIDs...))
+		}
+	}
+	return values
+}
+
+// Function to write resources in one of the machine-readable formats
+func writeResources(w io.Writer, format string, resources []Resource) error {
+	rows := make([][]interface{}, len(resources))
+	for i, r := range resources {
+		rows[i] = resourceValues(r)
+	}
+	return writeRecords(w, format, resourceColumns(), rows)
+}
+
+// Function to write playlists in one of the machine-readable formats
+func writePlaylists(w io.Writer, format string, playlists []Playlist) error {
+	rows := make([][]interface{}, len(playlists))
+	for i, p := range playlists {
+		rows[i] = playlistValues(p)
+	}
+	return writeRecords(w, format, playlistColumns(), rows)
+}
+
+// Function to write rows of string, int or []string values under the given columns
+func writeRecords(w io.Writer, format string, columns []outputColumn, rows [][]interface{}) error {
+	switch format {
+	case formatJSON:
+		objects := make([]orderedObject, len(rows))
+		for i, row := range rows {
+			objects[i] = orderedObject{columns, row}
+		}
+		data, err := marshalJSON(objects, "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case formatJSONL:
+		for _, row := range rows {
+			data, err := marshalJSON(orderedObject{columns, row}, "")
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "%s\n", data); err != nil {
+				return err
+			}
+		}
+		return nil
+	case formatCSV, formatTSV:
+		return writeDelimited(w, format == formatTSV, columns, rows)
+	case formatMarkdown:
+		return writeMarkdown(w, columns, rows)
+	case formatYAML:
+		return writeYAML(w, columns, rows)
+	}
+	return fmt.Errorf("can't write %s here", format)
+}
+
+// orderedObject is a JSON object that keeps its keys in column order.
+type orderedObject struct {
+	columns []outputColumn
+	values  []interface{}
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, c := range o.columns {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(c.key)
+		value, err := marshalJSON(o.values[i], "")
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// Function to marshal JSON without escaping <, > and &, which are common in titles
+func marshalJSON(v interface{}, indent string) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(b.Bytes(), "\n"), nil
+}
+
+// Function to flatten a value into one cell, lists are joined with sep
+func cellText(value interface{}, sep string) string {
+	if list, ok := value.([]string); ok {
+		return strings.Join(list, sep)
+	}
+	return fmt.Sprint(value)
+}
+
+// Function to write CSV, or TSV where tabs and line breaks inside values become spaces
+func writeDelimited(w io.Writer, tsv bool, columns []outputColumn, rows [][]interface{}) error {
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.key
+	}
+	if tsv {
+		clean := strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ")
+		lines := [][]string{header}
+		for _, row := range rows {
+			cells := make([]string, len(row))
+			for i, v := range row {
+				cells[i] = clean.Replace(cellText(v, ","))
+			}
+			lines = append(lines, cells)
+		}
+		for _, cells := range lines {
+			if _, err := fmt.Fprintln(w, strings.Join(cells, "\t")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			cells[i] = cellText(v, ",")
+		}
+		cw.Write(cells)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Function to write a GitHub-flavored markdown table
+func writeMarkdown(w io.Writer, columns []outputColumn, rows [][]interface{}) error {
+	escape := strings.NewReplacer("|", `\|`, "\r\n", " ", "\n", " ")
+	var b strings.Builder
+	b.WriteString("|")
+	for _, c := range columns {
+		b.WriteString(" " + c.title + " |")
+	}
+	b.WriteString("\n|")
+	for range columns {
+		b.WriteString(" --- |")
+	}
+	b.WriteString("\n")
+	for _, row := range rows {
+		b.WriteString("|")
+		for _, v := range row {
+			b.WriteString(" " + escape.Replace(cellText(v, ", ")) + " |")
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Function to write a YAML list of mappings. Strings are written as JSON strings,
+// which YAML reads as double-quoted scalars, and numbers as plain integers.
+func writeYAML(w io.Writer, columns []outputColumn, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		_, err := fmt.Fprintln(w, "[]")
+		return err
+	}
+	var b strings.Builder
+	for _, row := range rows {
+		for i, c := range columns {
+			prefix := "  "
+			if i == 0 {
+				prefix = "- "
+			}
+			b.WriteString(prefix + c.key + ":")
+			switch v := row[i].(type) {
+			case []string:
+				if len(v) == 0 {
+					b.WriteString(" []\n")
+					continue
+				}
+				b.WriteString("\n")
+				for _, item := range v {
+					s, _ := marshalJSON(item, "")
+					b.WriteString("    - " + string(s) + "\n")
+				}
+			case int:
+				b.WriteString(" " + strconv.Itoa(v) + "\n")
+			default:
+				s, _ := marshalJSON(cellText(v, ""), "")
+				b.WriteString(" " + string(s) + "\n")
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Function to print a raw ANSI escape, only when colors are on
+func ansi(code string) {
+	if !color.NoColor {
+		fmt.Print(code)
+	}
+}
+
+// Function to color table columns, only when colors are on
+func setColumnColors(table *tablewriter.Table, colors ...tablewriter.Colors) {
+	if !color.NoColor {
+		table.SetColumnColor(colors...)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// How many candidates "did you mean" and the picker offer.
+const maxSuggestions = 8
+
+// Function to count the single-character edits that turn a into b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// Function to check that the letters of needle appear in hay in the same order, e.g. "tch12" in "tech012"
+func isSubsequence(needle, hay string) bool {
+	rest := []rune(hay)
+	for _, r := range needle {
+		i := 0
+		for i < len(rest) && rest[i] != r {
+			i++
+		}
+		if i == len(rest) {
+			return false
+		}
+		rest = rest[i+1:]
+	}
+	return true
+}
+
+// Function to allow about one typo per three characters
+func typoBudget(query string) int {
+	return max(1, len([]rune(query))/3)
+}
+
+// Function to score how well a resource matches a mistyped ID or title, lower is better
+func fuzzyScore(query string, r Resource) (float64, bool) {
+	q := strings.ToLower(strings.TrimSpace(query))
+	id, title := strings.ToLower(r.ID), strings.ToLower(r.Title)
+	if q == "" {
+		return 0, false
+	}
+	if q == id || q == title {
+		return 0, true
+	}
+	best, ok := 0.0, false
+	consider := func(score float64) {
+		if !ok || score < best {
+			best, ok = score, true
+		}
+	}
+
+	if d := levenshtein(q, id); d <= typoBudget(q) {
+		consider(1 + float64(d))
+	}
+	if strings.Contains(title, q) {
+		consider(2 + float64(len(title)-len(q))/float64(len(title)+1))
+	}
+	if d := levenshtein(q, title); d <= typoBudget(q) {
+		consider(2 + float64(d))
+	}
+	if isSubsequence(q, id) {
+		consider(3 + float64(len(id)-len(q))/float64(len(id)+1))
+	}
+	// Every word typed is close to a word of the title, e.g. "pragmatik" or "design patern"
+	if d, all := wordDistance(splitWords(q), splitWords(title)); all {
+		consider(4 + d)
+	}
+	return best, ok
+}
+
+// Function to match each query word to its closest title word, all of them must be within the typo budget
+func wordDistance(query, title []string) (float64, bool) {
+	if len(query) == 0 {
+		return 0, false
+	}
+	total := 0
+	for _, q := range query {
+		best := -1
+		for _, w := range title {
+			if len(w) < 3 && w != q {
+				continue
+			}
+			if d := levenshtein(q, w); best < 0 || d < best {
+				best = d
+			}
+		}
+		if best < 0 || best > typoBudget(q) {
+			return 0, false
+		}
+		total += best
+	}
+	return float64(total) / float64(len(query)), true
+}
+
+// Function to find the resources closest to a mistyped ID or title, best first
+func (c *Catalog) Suggest(query string, limit int) ([]Resource, error) {
+	if err := c.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	return suggestAmong(query, c.resources.List, limit), nil
+}
+
+// Function to find the resources of a list closest to a mistyped ID or title, best first
+func suggestAmong(query string, resources []Resource, limit int) []Resource {
+	type candidate struct {
+		pos   int
+		score float64
+	}
+	var candidates []candidate
+	for i, r := range resources {
+		if score, ok := fuzzyScore(query, r); ok {
+			candidates = append(candidates, candidate{i, score})
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool { return candidates[a].score < candidates[b].score })
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	suggestions := make([]Resource, len(candidates))
+	for k, cand := range candidates {
+		suggestions[k] = resources[cand.pos]
+	}
+	return suggestions
+}
+
+// Function to cut long text to at most n characters
+func shorten(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+// Function to let the user pick one of several resources by number, ok is false if they cancel
+func pickResource(reader *bufio.Reader, candidates []Resource) (Resource, bool) {
+	for i, r := range candidates {
+		fmt.Printf("  [%d] %s  %s\n", i+1, color.New(color.Bold).Sprint(r.ID), shorten(r.Title, 70))
+	}
+	fmt.Print("Pick a number, or press Enter to cancel: ")
+	choice, _ := reader.ReadString('\n')
+	n, err := strconv.Atoi(strings.TrimSpace(choice))
+	if err != nil || n < 1 || n > len(candidates) {
+		return Resource{}, false
+	}
+	return candidates[n-1], true
+}
+
+// Function to read a resource ID. Typing ?words instead opens a picker over the closest matches.
+func promptResourceID(reader *bufio.Reader, prompt string) string {
+	return promptResourceIDFrom(reader, prompt, catalog.Suggest)
+}
+
+// Function to read a resource ID like promptResourceID, with the picker offering what suggest finds
+func promptResourceIDFrom(reader *bufio.Reader, prompt string, suggest func(query string, limit int) ([]Resource, error)) string {
+	fmt.Print(prompt)
+	input, _ := reader.ReadString('\n')
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(input, "?") {
+		return input
+	}
+
+	query := strings.TrimSpace(strings.TrimPrefix(input, "?"))
+	candidates, err := suggest(query, maxSuggestions)
+	if err != nil {
+		color.Red("Error loading resources: %v", err)
+		return ""
+	}
+	if len(candidates) == 0 {
+		color.Yellow("Nothing looks like '%s'.", query)
+		return ""
+	}
+	r, ok := pickResource(reader, candidates)
+	if !ok {
+		return ""
+	}
+	return r.ID
+}
+
+// Function to look up a resource by ID, offering the closest matches when there is none.
+// The position is -1 if nothing was found or picked.
+func findResourceOrSuggest(reader *bufio.Reader, id string) (Resource, int, error) {
+	r, i, err := catalog.Lookup(id)
+	if err != nil || i >= 0 || id == "" {
+		return r, i, err
+	}
+	candidates, err := catalog.Suggest(id, maxSuggestions)
+	if err != nil {
+		return Resource{}, -1, err
+	}
+	if len(candidates) == 0 {
+		color.Yellow("Resource with ID %s not found.", id)
+		return Resource{}, -1, nil
+	}
+	color.Yellow("Resource with ID %s not found. Did you mean:", id)
+	picked, ok := pickResource(reader, candidates)
+	if !ok {
+		return Resource{}, -1, nil
+	}
+	return catalog.Lookup(picked.ID)
+}
+
+// Function to find a resource by ID in a list, offering the closest ones when it isn't there.
+// where says what the list is, e.g. "in playlist Go"; ok is false if nothing was found or picked.
+func findAmongOrSuggest(reader *bufio.Reader, id string, resources []Resource, where string) (Resource, bool) {
+	for _, r := range resources {
+		if strings.EqualFold(r.ID, id) {
+			return r, true
+		}
+	}
+	candidates := suggestAmong(id, resources, maxSuggestions)
+	if len(candidates) == 0 {
+		color.Yellow("Resource with ID %s not found %s.", id, where)
+		return Resource{}, false
+	}
+	color.Yellow("Resource with ID %s not found %s. Did you mean:", id, where)
+	return pickResource(reader, candidates)
+}
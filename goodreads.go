@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// Goodreads keeps every book on exactly one of these shelves, they map to a status.
+var goodreadsShelves = map[string]string{
+	"read":              "viewed",
+	"currently-reading": "in-progress",
+	"to-read":           "unread",
+}
+
+const goodreadsBookURL = "https://www.goodreads.com/book/show/"
+
+func init() {
+	importers.register("goodreads", "<goodreads_library_export.csv> [--genre books] [--update] [flags]",
+		"Import books from a Goodreads library export, shelves become the status", importGoodreads)
+	exporters.register("goodreads", "[file] [--all]",
+		"Export the books as a CSV Goodreads can import, the status becomes the shelf", exportGoodreads)
+}
+
+func importGoodreads(fs *flag.FlagSet, args []string) error {
+	opts := addImportFlags(fs)
+	genre := fs.String("genre", "books", "genre of the imported books, Goodreads doesn't have one")
+	update := fs.Bool("update", false, "bring books already in the catalog up to date with their shelf, rating and ISBN")
+	rest, err := parseExactArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(rest[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	resources, skipped, err := readGoodreadsLibrary(f, *genre)
+	if err != nil {
+		return fmt.Errorf("%s: %w", rest[0], err)
+	}
+	batch := importBatch{
+		command:     "import-goodreads",
+		source:      filepath.Base(rest[0]),
+		resources:   resources,
+		skippedRows: skipped,
+	}
+	if *update {
+		batch.merge = mergeGoodreadsBook
+	}
+	return commitImport(stdin, batch, opts)
+}
+
+// Function to read the books of a Goodreads library export, returns how many rows were skipped
+func readGoodreadsLibrary(r io.Reader, genre string) ([]Resource, int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, 0, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	position := make(map[string]int)
+	for i, h := range header {
+		position[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	if _, ok := position["title"]; !ok {
+		return nil, 0, usageErrorf("this isn't a Goodreads library export, there is no Title column")
+	}
+
+	var resources []Resource
+	skipped := 0
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		line, _ := reader.FieldPos(0)
+		cell := func(column string) string {
+			if i, ok := position[column]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+
+		title := cell("title")
+		if title == "" {
+			color.Yellow("Skipping line %d: no title.", line)
+			skipped++
+			continue
+		}
+		book := Resource{
+			Title:  title,
+			Author: cell("author"),
+			Genre:  genre,
+			Type:   "book",
+			ISBN:   cleanISBN(cell("isbn13")),
+			Tags:   []string{},
+		}
+		if book.ISBN == "" {
+			book.ISBN = cleanISBN(cell("isbn"))
+		}
+		if id := cell("book id"); id != "" {
+			book.Link = goodreadsBookURL + id
+		}
+		if book.Rating, err = parseRating(cell("my rating")); err != nil {
+			color.Yellow("Ignoring the rating on line %d: %v", line, err)
+		}
+
+		shelf := strings.ToLower(cell("exclusive shelf"))
+		book.Status = goodreadsShelves[shelf]
+		if book.Status == "" {
+			// A custom exclusive shelf, keep it as a tag
+			book.Status = "unread"
+			if shelf != "" {
+				book.Tags = append(book.Tags, shelf)
+			}
+		}
+		for _, s := range strings.Split(cell("bookshelves"), ",") {
+			s = strings.TrimSpace(s)
+			if _, exclusive := goodreadsShelves[strings.ToLower(s)]; s != "" && !exclusive && !strings.EqualFold(s, shelf) {
+				book.Tags = append(book.Tags, s)
+			}
+		}
+		resources = append(resources, book)
+	}
+	return resources, skipped, nil
+}
+
+// Function to update a book already in the catalog from Goodreads: the shelf and rating
+// win, the ISBN, author and link only fill in what's missing, shelves are added as tags
+func mergeGoodreadsBook(existing, book Resource) Resource {
+	merged := existing
+	merged.Status = book.Status
+	if book.Rating > 0 {
+		merged.Rating = book.Rating
+	}
+	if merged.ISBN == "" {
+		merged.ISBN = book.ISBN
+	}
+	if merged.Author == "" {
+		merged.Author = book.Author
+	}
+	if merged.Link == "" {
+		merged.Link = book.Link
+	}
+	merged.Tags = append([]string{}, existing.Tags...)
+	for _, tag := range book.Tags {
+		if !containsFold(merged.Tags, tag) {
+			merged.Tags = append(merged.Tags, tag)
+		}
+	}
+	return merged
+}
+
+func exportGoodreads(fs *flag.FlagSet, args []string) error {
+	all := fs.Bool("all", false, "export every resource, not only books")
+	path, err := parseExportArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	resources, err := catalog.Resources()
+	if err != nil {
+		return fmt.Errorf("loading resources: %w", err)
+	}
+	var books []Resource
+	for _, r := range resources {
+		if *all || strings.EqualFold(r.Type, "book") {
+			books = append(books, r)
+		}
+	}
+	return writeExport(path, len(books), func(w io.Writer) error {
+		return writeGoodreadsCSV(w, books)
+	})
+}
+
+// Function to write books in the columns of a Goodreads library export, which is also
+// what Goodreads' import reads
+func writeGoodreadsCSV(w io.Writer, books []Resource) error {
+	shelfOf := make(map[string]string)
+	for shelf, status := range goodreadsShelves {
+		shelfOf[status] = shelf
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Book Id", "Title", "Author", "ISBN", "ISBN13", "My Rating", "Exclusive Shelf", "Bookshelves"})
+	for _, b := range books {
+		var bookID, isbn, isbn13, rating string
+		if strings.HasPrefix(b.Link, goodreadsBookURL) {
+			bookID = strings.TrimPrefix(b.Link, goodreadsBookURL)
+		}
+		if len(b.ISBN) == 13 {
+			isbn13 = b.ISBN
+		} else {
+			isbn = b.ISBN
+		}
+		if b.Rating > 0 {
+			rating = fmt.Sprint(b.Rating)
+		}
+		shelf, ok := shelfOf[b.Status]
+		if !ok {
+			shelf = "to-read"
+		}
+		// Goodreads shelf names can't have spaces
+		shelves := make([]string, len(b.Tags))
+		for i, tag := range b.Tags {
+			shelves[i] = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(tag)), " ", "-")
+		}
+		cw.Write([]string{bookID, b.Title, b.Author, isbn, isbn13, rating, shelf, strings.Join(shelves, ", ")})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadGoodreadsLibraryShelves(t *testing.T) {
+	tests := []struct {
+		shelf, bookshelves string
+		wantStatus         string
+		wantTags           []string
+	}{
+		{"read", "", "viewed", []string{}},
+		{"currently-reading", "", "in-progress", []string{}},
+		{"to-read", "", "unread", []string{}},
+		{"Read", "read", "viewed", []string{}},
+		{"read", "favourites, read, to-read", "viewed", []string{"favourites"}},
+		{"did-not-finish", "did-not-finish, audiobook", "unread", []string{"did-not-finish", "audiobook"}},
+		{"Abandoned", "abandoned", "unread", []string{"abandoned"}},
+		{"", "", "unread", []string{}},
+	}
+	for _, tt := range tests {
+		file := "Book Id,Title,Author,ISBN,ISBN13,My Rating,Exclusive Shelf,Bookshelves\n" +
+			`1,A Book,Someone,,,0,` + tt.shelf + `,"` + tt.bookshelves + `"` + "\n"
+		books, _, err := readGoodreadsLibrary(strings.NewReader(file), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(books) != 1 || books[0].Status != tt.wantStatus || !reflect.DeepEqual(books[0].Tags, tt.wantTags) {
+			t.Errorf("shelf %q with bookshelves %q read as %+v, want status %s and tags %q", tt.shelf, tt.bookshelves, books, tt.wantStatus, tt.wantTags)
+		}
+	}
+}
+
+func TestReadGoodreadsLibraryRow(t *testing.T) {
+	file := "\ufeffBook Id,Title,Author,ISBN,ISBN13,My Rating,Exclusive Shelf,Bookshelves\n" +
+		`42,Dune,Frank Herbert,"=""0441013597""","=""9780441013593""",4,read,` + "\n" +
+		`43,Untouched,,"=""0441013597""",,9,to-read,` + "\n" +
+		`44,,Nobody,,,,read,` + "\n"
+	books, skipped, err := readGoodreadsLibrary(strings.NewReader(file), "fiction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 1 || len(books) != 2 {
+		t.Fatalf("read %d book(s) and skipped %d, want 2 and 1", len(books), skipped)
+	}
+	want := Resource{Title: "Dune", Author: "Frank Herbert", Genre: "fiction", Type: "book", Status: "viewed",
+		ISBN: "9780441013593", Rating: 4, Link: goodreadsBookURL + "42", Tags: []string{}}
+	if !reflect.DeepEqual(books[0], want) {
+		t.Errorf("read %+v, want %+v", books[0], want)
+	}
+	if books[1].ISBN != "0441013597" || books[1].Rating != 0 {
+		t.Errorf("read %+v, want the ISBN-10 and no rating", books[1])
+	}
+}
+
+func TestMergeGoodreadsBook(t *testing.T) {
+	tests := []struct {
+		name           string
+		existing, book Resource
+		want           Resource
+	}{
+		{"the shelf and rating win",
+			Resource{ID: "fiction001", Title: "Dune", Status: "unread", Rating: 2, Tags: []string{}},
+			Resource{Title: "Dune", Status: "viewed", Rating: 5, Tags: []string{}},
+			Resource{ID: "fiction001", Title: "Dune", Status: "viewed", Rating: 5, Tags: []string{}}},
+		{"no rating keeps the catalog's",
+			Resource{Title: "Dune", Status: "viewed", Rating: 3, Tags: []string{}},
+			Resource{Title: "Dune", Status: "in-progress", Tags: []string{}},
+			Resource{Title: "Dune", Status: "in-progress", Rating: 3, Tags: []string{}}},
+		{"ISBN, author and link only fill in",
+			Resource{Title: "Dune", Author: "F. Herbert", Link: "https://example.com/dune", Tags: []string{}},
+			Resource{Title: "Dune", Author: "Frank Herbert", ISBN: "9780441013593", Link: goodreadsBookURL + "42", Status: "unread", Tags: []string{}},
+			Resource{Title: "Dune", Author: "F. Herbert", ISBN: "9780441013593", Link: "https://example.com/dune", Status: "unread", Tags: []string{}}},
+		{"missing fields come from Goodreads",
+			Resource{Title: "Dune", ISBN: "0441013597", Tags: []string{}},
+			Resource{Title: "Dune", Author: "Frank Herbert", ISBN: "9780441013593", Link: goodreadsBookURL + "42", Status: "viewed", Tags: []string{}},
+			Resource{Title: "Dune", Author: "Frank Herbert", ISBN: "0441013597", Link: goodreadsBookURL + "42", Status: "viewed", Tags: []string{}}},
+		{"shelves are added as tags once",
+			Resource{Title: "Dune", Tags: []string{"Classics", "space"}},
+			Resource{Title: "Dune", Status: "viewed", Tags: []string{"classics", "favourites"}},
+			Resource{Title: "Dune", Status: "viewed", Tags: []string{"Classics", "space", "favourites"}}},
+	}
+	for _, tt := range tests {
+		existingTags := append(tt.existing.Tags[:0:0], tt.existing.Tags...)
+		if got := mergeGoodreadsBook(tt.existing, tt.book); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: merged %+v, want %+v", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(tt.existing.Tags, existingTags) {
+			t.Errorf("%s: the catalog's tags changed to %q", tt.name, tt.existing.Tags)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+)
+
+// csvMapping says how the columns of a CSV file become resource fields. It can be
+// given with flags or as a JSON config file:
+//
+//	{
+//	  "delimiter": ";",
+//	  "columns": {"Book Title": "title", "Written by": "author", "Shelf": "tags"},
+//	  "defaults": {"type": "book", "genre": "history"},
+//	  "tag_separator": "|"
+//	}
+//
+// Several columns can map to tags, their values are combined. A column can also be
+// given by its position, "#1" for the first.
+type csvMapping struct {
+	Delimiter    string            `json:"delimiter,omitempty"`
+	Columns      map[string]string `json:"columns,omitempty"`       // header -> field
+	Defaults     map[string]string `json:"defaults,omitempty"`      // field -> value when the column is missing or empty
+	TagSeparator string            `json:"tag_separator,omitempty"` // splits a tags cell, "," if not set
+}
+
+// The fields a CSV column can map to.
+var csvFields = []string{"id", "title", "author", "genre", "type", "status", "link", "tags", "isbn", "rating"}
+
+func isCSVField(field string) bool {
+	for _, f := range csvFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	importers.register("csv", "<file> [--map 'Header=field,...'] [--config mapping.json] [flags]",
+		"Import resources from a CSV file, mapping its columns to resource fields", importCSV)
+}
+
+// Function to parse a list like "Book Title=title,Author=author" into a map
+func parsePairs(list, what string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, usageErrorf("%s %q should look like key=value", what, item)
+		}
+		pairs[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return pairs, nil
+}
+
+// Function to read a delimiter given as a character, "tab" or "\t"
+func parseDelimiter(value string) (rune, error) {
+	switch strings.ToLower(value) {
+	case "", ",", "comma":
+		return ',', nil
+	case "tab", `\t`, "\t":
+		return '\t', nil
+	case "semicolon":
+		return ';', nil
+	case "pipe":
+		return '|', nil
+	}
+	r, size := utf8.DecodeRuneInString(value)
+	if size != len(value) || r == '"' || r == '\r' || r == '\n' {
+		return 0, usageErrorf("the delimiter must be a single character, got %q", value)
+	}
+	return r, nil
+}
+
+func importCSV(fs *flag.FlagSet, args []string) error {
+	opts := addImportFlags(fs)
+	mapFlag := fs.String("map", "", "column mapping, e.g. 'Book Title=title,Writer=author' (columns named like a field map on their own)")
+	configFlag := fs.String("config", "", "JSON file with the mapping, delimiter, defaults and tag separator")
+	delimiterFlag := fs.String("delimiter", "", "field delimiter: a character, tab, semicolon or pipe (default ,)")
+	defaultsFlag := fs.String("default", "", "values for missing or empty columns, e.g. 'type=book,status=unread'")
+	tagSepFlag := fs.String("tag-separator", "", "separator inside a tags cell (default ,)")
+	rest, err := parseExactArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	var mapping csvMapping
+	if *configFlag != "" {
+		data, err := ioutil.ReadFile(*configFlag)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &mapping); err != nil {
+			return usageErrorf("%s: %v", *configFlag, err)
+		}
+	}
+	// Flags win over the config file
+	if mapping.Columns == nil {
+		mapping.Columns = make(map[string]string)
+	}
+	if mapping.Defaults == nil {
+		mapping.Defaults = make(map[string]string)
+	}
+	columns, err := parsePairs(*mapFlag, "mapping")
+	if err != nil {
+		return err
+	}
+	for header, field := range columns {
+		mapping.Columns[header] = field
+	}
+	defaults, err := parsePairs(*defaultsFlag, "default")
+	if err != nil {
+		return err
+	}
+	for field, value := range defaults {
+		mapping.Defaults[field] = value
+	}
+	if *delimiterFlag != "" {
+		mapping.Delimiter = *delimiterFlag
+	}
+	if *tagSepFlag != "" {
+		mapping.TagSeparator = *tagSepFlag
+	}
+
+	f, err := os.Open(rest[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	resources, skipped, err := readCSVResources(f, mapping)
+	if err != nil {
+		return fmt.Errorf("%s: %w", rest[0], err)
+	}
+	return commitImport(stdin, importBatch{
+		command:     "import-csv",
+		source:      filepath.Base(rest[0]),
+		resources:   resources,
+		skippedRows: skipped,
+	}, opts)
+}
+
+// Function to turn the rows of a CSV file into resources, returns how many rows were skipped
+func readCSVResources(r io.Reader, mapping csvMapping) ([]Resource, int, error) {
+	delimiter, err := parseDelimiter(mapping.Delimiter)
+	if err != nil {
+		return nil, 0, err
+	}
+	defaults := make(map[string]string)
+	for field, value := range mapping.Defaults {
+		if field = strings.ToLower(field); !isCSVField(field) {
+			return nil, 0, usageErrorf("unknown field %q in the defaults, use one of %s", field, strings.Join(csvFields, ", "))
+		}
+		defaults[field] = value
+	}
+	tagSep := mapping.TagSeparator
+	if tagSep == "" {
+		tagSep = ","
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1 // Rows with missing trailing columns are fine
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, 0, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff") // Excel writes a byte order mark
+	}
+
+	// column position -> field
+	fieldOf := make(map[int]string)
+	position := make(map[string]int)
+	for i, h := range header {
+		position[strings.ToLower(strings.TrimSpace(h))] = i
+		if isCSVField(strings.ToLower(strings.TrimSpace(h))) {
+			fieldOf[i] = strings.ToLower(strings.TrimSpace(h))
+		}
+	}
+	for column, field := range mapping.Columns {
+		field = strings.ToLower(field)
+		if !isCSVField(field) {
+			return nil, 0, usageErrorf("can't map %q to %q, use one of %s", column, field, strings.Join(csvFields, ", "))
+		}
+		i, ok := position[strings.ToLower(column)]
+		if n, err := strconv.Atoi(strings.TrimPrefix(column, "#")); !ok && err == nil && strings.HasPrefix(column, "#") && n >= 1 && n <= len(header) {
+			i, ok = n-1, true // #3 is the third column, whatever its header says
+		}
+		if !ok {
+			return nil, 0, usageErrorf("there is no column %q, the file has: %s", column, strings.Join(header, ", "))
+		}
+		fieldOf[i] = field
+	}
+	mapped := false
+	for _, field := range fieldOf {
+		mapped = mapped || field == "title"
+	}
+	if !mapped && defaults["title"] == "" {
+		return nil, 0, usageErrorf("no column is mapped to title, the file has: %s", strings.Join(header, ", "))
+	}
+
+	var resources []Resource
+	skipped := 0
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		line, _ := reader.FieldPos(0)
+		values := make(map[string]string)
+		var tags []string
+		for i, cell := range row {
+			field, ok := fieldOf[i]
+			cell = strings.TrimSpace(cell)
+			if !ok || cell == "" {
+				continue
+			}
+			if field == "tags" {
+				for _, tag := range strings.Split(cell, tagSep) {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						tags = append(tags, tag)
+					}
+				}
+				continue
+			}
+			values[field] = cell
+		}
+		for field, value := range defaults {
+			if field == "tags" && len(tags) == 0 {
+				for _, tag := range strings.Split(value, tagSep) {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						tags = append(tags, tag)
+					}
+				}
+			} else if values[field] == "" {
+				values[field] = value
+			}
+		}
+		if values["title"] == "" {
+			color.Yellow("Skipping line %d: no title.", line)
+			skipped++
+			continue
+		}
+		rating, err := parseRating(values["rating"])
+		if err != nil {
+			color.Yellow("Ignoring the rating on line %d: %v", line, err)
+		}
+		resources = append(resources, Resource{
+			ID:     values["id"],
+			Title:  values["title"],
+			Author: values["author"],
+			Genre:  values["genre"],
+			Type:   values["type"],
+			Status: values["status"],
+			Link:   values["link"],
+			Tags:   tags,
+			ISBN:   cleanISBN(values["isbn"]),
+			Rating: rating,
+		})
+	}
+	return resources, skipped, nil
+}
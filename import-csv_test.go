@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCSVResourcesColumnPositions(t *testing.T) {
+	const file = "Name,Writer,#1,Extra\nDune,Frank Herbert,sci-fi,https://example.com/dune\n"
+	tests := []struct {
+		name    string
+		columns map[string]string
+		want    Resource
+		err     string
+	}{
+		{"by position", map[string]string{"#2": "title", "#4": "link"},
+			Resource{Title: "Frank Herbert", Link: "https://example.com/dune"}, ""},
+		{"a header named #1 wins over the first column", map[string]string{"Name": "title", "#1": "genre"},
+			Resource{Title: "Dune", Genre: "sci-fi"}, ""},
+		{"headers ignore case", map[string]string{"name": "Title", "WRITER": "author"},
+			Resource{Title: "Dune", Author: "Frank Herbert"}, ""},
+		{"past the last column", map[string]string{"Name": "title", "#5": "link"}, Resource{}, `there is no column "#5"`},
+		{"columns count from one", map[string]string{"Name": "title", "#0": "link"}, Resource{}, `there is no column "#0"`},
+		{"not a number", map[string]string{"Name": "title", "#x": "link"}, Resource{}, `there is no column "#x"`},
+		{"unknown field", map[string]string{"#1": "colour"}, Resource{}, `can't map "#1" to "colour"`},
+		{"nothing is the title", map[string]string{"#2": "author"}, Resource{}, "no column is mapped to title"},
+	}
+	for _, tt := range tests {
+		resources, _, err := readCSVResources(strings.NewReader(file), csvMapping{Columns: tt.columns})
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(resources) != 1 || !reflect.DeepEqual(resources[0], tt.want) {
+			t.Errorf("%s: read %+v, want %+v", tt.name, resources, tt.want)
+		}
+	}
+}
+
+func TestReadCSVResourcesDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		mapping  csvMapping
+		wantTags [][]string
+		wantType []string
+	}{
+		{"default tags when the cell is empty",
+			"title,tags\nA,\nB,own\n",
+			csvMapping{Defaults: map[string]string{"tags": "club, books"}},
+			[][]string{{"club", "books"}, {"own"}}, []string{"", ""}},
+		{"default tags without a tags column",
+			"title\nA\n",
+			csvMapping{Defaults: map[string]string{"Tags": "x| |y"}, TagSeparator: "|"},
+			[][]string{{"x", "y"}}, []string{""}},
+		{"several tag columns are combined",
+			"title,shelf,labels\nA,read,\"a;b\"\n",
+			csvMapping{Columns: map[string]string{"shelf": "tags", "labels": "tags"}, TagSeparator: ";"},
+			[][]string{{"read", "a", "b"}}, []string{""}},
+		{"other defaults fill empty cells only",
+			"title,type\nA,\nB,video\n",
+			csvMapping{Defaults: map[string]string{"type": "book"}},
+			[][]string{nil, nil}, []string{"book", "video"}},
+		{"a default title keeps untitled rows",
+			"author\nSomeone\n",
+			csvMapping{Defaults: map[string]string{"title": "Untitled"}},
+			[][]string{nil}, []string{""}},
+	}
+	for _, tt := range tests {
+		resources, skipped, err := readCSVResources(strings.NewReader(tt.file), tt.mapping)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if skipped != 0 || len(resources) != len(tt.wantTags) {
+			t.Errorf("%s: read %d resource(s) and skipped %d, want %d", tt.name, len(resources), skipped, len(tt.wantTags))
+			continue
+		}
+		for i, r := range resources {
+			if !reflect.DeepEqual(r.Tags, tt.wantTags[i]) || r.Type != tt.wantType[i] {
+				t.Errorf("%s: row %d has tags %q and type %q, want %q and %q", tt.name, i+1, r.Tags, r.Type, tt.wantTags[i], tt.wantType[i])
+			}
+		}
+	}
+
+	if _, _, err := readCSVResources(strings.NewReader("title\nA\n"), csvMapping{Defaults: map[string]string{"colour": "red"}}); err == nil {
+		t.Error("a default for an unknown field was accepted")
+	}
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/fatih/color"
+	"github.com/google/uuid"
+	"github.com/olekukonko/tablewriter"
+)
+
+// importers holds every format `import` understands, `import <name> <file> [flags]`.
+var importers = newFormatRegistry("import", "<file> [flags]")
+
+// importOptions are the flags every importer shares.
+type importOptions struct {
+	preview *int
+	dryRun  *bool
+	yes     *bool
+}
+
+func addImportFlags(fs *flag.FlagSet) importOptions {
+	return importOptions{
+		preview: fs.Int("preview", 5, "how many of the new resources to show before importing"),
+		dryRun:  fs.Bool("dry-run", false, "only show what would be imported"),
+		yes:     fs.Bool("yes", false, "import without asking"),
+	}
+}
+
+// importBatch is what an importer read from its source.
+type importBatch struct {
+	command     string // e.g. "import-csv", names the backup and the history entry
+	source      string // e.g. the file name, for messages
+	resources   []Resource
+	skippedRows int // rows the importer couldn't use, already reported
+	// merge, when set, folds an incoming resource into the catalog resource it
+	// duplicates instead of skipping it
+	merge func(existing, incoming Resource) Resource
+	// playlists to create or extend, name -> positions in resources. Duplicates
+	// count too, with the ID of the resource they match.
+	playlists map[string][]int
+	genre     string // for new resources without one, existing ones keep theirs
+	// linksOnly matches duplicates by link alone, for titles like "Episode 12" that
+	// repeat from one podcast to the next
+	linksOnly bool
+}
+
+// Function to normalize a title for duplicate checks: lowercase words without punctuation
+func normalizeTitle(title string) string {
+	return strings.Join(splitWords(stripListNumber(title)), " ")
+}
+
+// Function to drop the "3) " the paper scraper keeps from its numbered lists
+func stripListNumber(title string) string {
+	title = strings.TrimSpace(title)
+	digits := strings.IndexFunc(title, func(r rune) bool { return r < '0' || r > '9' })
+	if digits > 0 && strings.HasPrefix(title[digits:], ") ") {
+		return strings.TrimSpace(title[digits+2:])
+	}
+	return title
+}
+
+// Function to normalize a link for duplicate checks, so http/https, www., a trailing
+// slash and the fragment don't make two links to the same page differ
+func normalizeLink(link string) string {
+	link = strings.TrimSpace(link)
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return strings.ToLower(strings.TrimSuffix(link, "/"))
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	path := strings.TrimSuffix(u.EscapedPath(), "/")
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return host + path
+}
+
+// Function to clean up an ISBN: Goodreads writes ="0345339681" so spreadsheets keep
+// the leading zeros, others add hyphens or spaces
+func cleanISBN(isbn string) string {
+	isbn = strings.TrimPrefix(strings.TrimSpace(isbn), "=")
+	return strings.ToUpper(strings.NewReplacer(`"`, "", "-", "", " ", "").Replace(isbn))
+}
+
+// Function to read a 0 to 5 star rating, 0 (or nothing) means not rated
+func parseRating(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	rating, err := strconv.Atoi(value)
+	if err != nil || rating < 0 || rating > 5 {
+		return 0, fmt.Errorf("%q isn't a rating from 0 to 5", value)
+	}
+	return rating, nil
+}
+
+// Function to check whether a list holds s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// catalogMatcher finds the resource an incoming one duplicates, by ID, link or title.
+type catalogMatcher struct {
+	byID, byLink, byTitle map[string]int
+}
+
+func newCatalogMatcher(resources []Resource) *catalogMatcher {
+	m := &catalogMatcher{byID: map[string]int{}, byLink: map[string]int{}, byTitle: map[string]int{}}
+	for i, r := range resources {
+		m.add(r, i)
+	}
+	return m
+}
+
+func (m *catalogMatcher) add(r Resource, i int) {
+	if r.ID != "" {
+		m.byID[strings.ToLower(r.ID)] = i
+	}
+	if link := normalizeLink(r.Link); link != "" {
+		m.byLink[link] = i
+	}
+	if title := normalizeTitle(r.Title); title != "" {
+		m.byTitle[title] = i
+	}
+}
+
+// Function to find the position of the resource r duplicates, -1 if it is new.
+// A link is the strongest match, then the ID, then the title.
+func (m *catalogMatcher) find(r Resource) int {
+	if i := m.findLink(r); i >= 0 {
+		return i
+	}
+	if i, ok := m.byID[strings.ToLower(r.ID)]; ok && r.ID != "" {
+		return i
+	}
+	if i, ok := m.byTitle[normalizeTitle(r.Title)]; ok && r.Title != "" {
+		return i
+	}
+	return -1
+}
+
+func (m *catalogMatcher) findLink(r Resource) int {
+	if i, ok := m.byLink[normalizeLink(r.Link)]; ok && r.Link != "" {
+		return i
+	}
+	return -1
+}
+
+// idAllocator hands out IDs like tech042 that aren't in the catalog yet.
+type idAllocator struct {
+	taken   map[string]bool
+	highest map[string]int // prefix -> highest number handed out or seen
+}
+
+func newIDAllocator(resources []Resource) *idAllocator {
+	a := &idAllocator{taken: make(map[string]bool, len(resources)), highest: make(map[string]int)}
+	for _, r := range resources {
+		a.reserve(r.ID)
+	}
+	return a
+}
+
+func (a *idAllocator) reserve(id string) {
+	a.taken[strings.ToLower(id)] = true
+}
+
+// Function to turn a genre into an ID prefix the way the catalog does, "AI ML" -> "ai-ml"
+func idPrefix(genre string) string {
+	prefix := strings.Join(strings.FieldsFunc(strings.ToLower(genre), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), "-")
+	if prefix == "" {
+		return "resource"
+	}
+	return prefix
+}
+
+// Function to get the next free ID for a genre, one above the highest one in use
+func (a *idAllocator) next(genre string) string {
+	prefix := idPrefix(genre)
+	highest, ok := a.highest[prefix]
+	if !ok {
+		for id := range a.taken {
+			if n, err := strconv.Atoi(strings.TrimPrefix(id, prefix)); err == nil && strings.HasPrefix(id, prefix) && n > highest {
+				highest = n
+			}
+		}
+	}
+	for n := highest + 1; ; n++ {
+		id := fmt.Sprintf("%s%03d", prefix, n)
+		if !a.taken[id] {
+			a.reserve(id)
+			a.highest[prefix] = n
+			return id
+		}
+	}
+}
+
+// Function to render resources with every field, for previews
+func previewResources(resources []Resource, limit int) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoFormatHeaders(false)
+	table.SetRowLine(true)
+	table.SetHeader([]string{"ID", "Title", "Author", "Genre", "Type", "Status", "Tags", "Link"})
+	for i, r := range resources {
+		if i == limit {
+			break
+		}
+		table.Append([]string{r.ID, shorten(r.Title, 50), shorten(r.Author, 25), r.Genre, r.Type, r.Status,
+			shorten(strings.Join(r.Tags, ", "), 30), shorten(r.Link, 40)})
+	}
+	table.Render()
+	if len(resources) > limit {
+		fmt.Printf("... and %d more\n", len(resources)-limit)
+	}
+}
+
+// Function to add an importer's resources to the catalog. Duplicates of resources already
+// in the catalog (same link, ID or title) are skipped, or merged into them if the batch
+// has a merge function, new ones without an ID get one. The batch's playlists are created,
+// or extended if one with the same name exists. The changes are previewed and, unless
+// --yes, confirmed first. The import takes a backup and is recorded in the history, so it
+// can be undone.
+func commitImport(reader *bufio.Reader, batch importBatch, opts importOptions) error {
+	resources, err := loadResources()
+	if err != nil {
+		return fmt.Errorf("loading resources: %w", err)
+	}
+
+	plan := planImport(resources.List, batch)
+	added, updates, duplicates := plan.added, plan.updates, plan.duplicates
+
+	var playlists Playlists
+	var playlistChanges []playlistChange
+	if len(batch.playlists) > 0 {
+		if playlists, err = loadPlaylists(); err != nil {
+			return fmt.Errorf("loading playlists: %w", err)
+		}
+		playlistChanges = planImportPlaylists(playlists.List, batch.playlists, plan.ids)
+	}
+
+	if batch.merge != nil {
+		color.Cyan("%s: %d new resource(s), %d already in the catalog, %d of them to update.", batch.source, len(added), duplicates, len(updates))
+	} else {
+		color.Cyan("%s: %d new resource(s), %d already in the catalog.", batch.source, len(added), duplicates)
+	}
+	if batch.skippedRows > 0 {
+		color.Yellow("%d row(s) were skipped, see the warnings above.", batch.skippedRows)
+	}
+	if len(added) == 0 && len(updates) == 0 && len(playlistChanges) == 0 {
+		return nil
+	}
+	if len(added) > 0 {
+		previewResources(added, *opts.preview)
+	}
+	for k, c := range updates {
+		if k == *opts.preview {
+			fmt.Printf("... and %d more update(s)\n", len(updates)-k)
+			break
+		}
+		fmt.Printf("~ %s %s: %s\n", c.ID, c.After.Title, strings.Join(changedFields(*c.Before, *c.After), ", "))
+	}
+	for _, c := range playlistChanges {
+		if c.Before == nil {
+			fmt.Printf("+ playlist '%s' with %d resource(s)\n", c.After.Name, len(c.After.ResourceIDs))
+		} else {
+			fmt.Printf("~ playlist '%s': %d more resource(s)\n", c.After.Name, len(c.After.ResourceIDs)-len(c.Before.ResourceIDs))
+		}
+	}
+	if *opts.dryRun {
+		color.Yellow("Dry run: nothing was imported.")
+		return nil
+	}
+	if !*opts.yes {
+		question := fmt.Sprintf("Import %d resource(s)", len(added))
+		if len(updates) > 0 {
+			question += fmt.Sprintf(", update %d", len(updates))
+		}
+		if len(playlistChanges) > 0 {
+			question += fmt.Sprintf(", change %d playlist(s)", len(playlistChanges))
+		}
+		fmt.Printf("%s? (y/N): ", question)
+		answer, _ := reader.ReadString('\n')
+		if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+			color.Yellow("Import cancelled.")
+			return nil
+		}
+	}
+	if err := backupBefore(batch.command); err != nil {
+		return err
+	}
+
+	entry := journalEntry{Command: batch.command, Description: fmt.Sprintf("imported %d resources from %s", len(added), batch.source)}
+	if len(updates) > 0 {
+		entry.Description += fmt.Sprintf(", updated %d", len(updates))
+	}
+	if len(playlistChanges) > 0 {
+		entry.Description += fmt.Sprintf(", %d playlist(s)", len(playlistChanges))
+	}
+	entry.Resources = plan.apply(&resources)
+	if err := saveResources(resources); err != nil {
+		return fmt.Errorf("saving resources: %w", err)
+	}
+	if len(playlistChanges) > 0 {
+		for _, c := range playlistChanges {
+			if c.Index >= 0 {
+				playlists.List[c.Index] = *c.After
+			} else {
+				playlists.List = append(playlists.List, *c.After)
+			}
+		}
+		if err := savePlaylists(playlists); err != nil {
+			return fmt.Errorf("saving playlists: %w", err)
+		}
+		entry.Playlists = playlistChanges
+	}
+	recordOperation(entry)
+	if len(updates) > 0 {
+		color.Green("Imported %d resource(s) from %s and updated %d.", len(added), batch.source, len(updates))
+	} else {
+		color.Green("Imported %d resource(s) from %s.", len(added), batch.source)
+	}
+	return nil
+}
+
+// importPlan is what adding a batch to the catalog would change.
+type importPlan struct {
+	added      []Resource
+	updates    []resourceChange // merged duplicates, Index is their catalog position
+	ids        []string         // the ID each resource of the batch ended up with
+	duplicates int
+}
+
+// Function to match a batch against the catalog: duplicates (same link, ID or title) are
+// merged if the batch has a merge function and skipped otherwise, new resources get a free
+// ID, the unread status, empty tags and the current time if they lack them
+func planImport(existing []Resource, batch importBatch) importPlan {
+	matcher := newCatalogMatcher(existing)
+	ids := newIDAllocator(existing)
+	now := time.Now().UTC().Format(time.RFC3339)
+	plan := importPlan{ids: make([]string, len(batch.resources))}
+	updated := make(map[int]int) // catalog position -> index in updates
+	for n, r := range batch.resources {
+		i := matcher.find(r)
+		if batch.linksOnly {
+			i = matcher.findLink(r)
+		}
+		if i >= len(existing) {
+			plan.duplicates++ // Twice in the same batch
+			plan.ids[n] = plan.added[i-len(existing)].ID
+			continue
+		}
+		if i >= 0 {
+			plan.duplicates++
+			plan.ids[n] = existing[i].ID
+			if batch.merge == nil {
+				continue
+			}
+			current := existing[i]
+			if k, ok := updated[i]; ok {
+				current = *plan.updates[k].After
+			}
+			merged := batch.merge(current, r)
+			if k, ok := updated[i]; ok {
+				plan.updates[k].After = &merged
+				continue
+			}
+			if sameJSON(&existing[i], &merged) {
+				continue
+			}
+			before := existing[i]
+			updated[i] = len(plan.updates)
+			plan.updates = append(plan.updates, resourceChange{ID: before.ID, Index: i, Before: &before, After: &merged})
+			continue
+		}
+		if r.Genre == "" {
+			r.Genre = batch.genre
+		}
+		if r.ID == "" {
+			r.ID = ids.next(r.Genre)
+		} else {
+			ids.reserve(r.ID)
+		}
+		if r.Status == "" {
+			r.Status = "unread"
+		}
+		if r.Tags == nil {
+			r.Tags = []string{}
+		}
+		if r.AddedAt == "" {
+			r.AddedAt = now
+		}
+		matcher.add(r, len(existing)+len(plan.added))
+		plan.added = append(plan.added, r)
+		plan.ids[n] = r.ID
+	}
+	// A resource merged twice can end up as it was
+	kept := plan.updates[:0]
+	for _, c := range plan.updates {
+		if !sameJSON(c.Before, c.After) {
+			kept = append(kept, c)
+		}
+	}
+	plan.updates = kept
+	return plan
+}
+
+// Function to apply a plan to the resources, returns the changes for the history
+func (plan importPlan) apply(resources *Resources) []resourceChange {
+	changes := append([]resourceChange{}, plan.updates...)
+	for _, c := range plan.updates {
+		resources.List[c.Index] = *c.After
+	}
+	for i := range plan.added {
+		changes = append(changes, resourceChange{ID: plan.added[i].ID, Index: -1, After: &plan.added[i]})
+	}
+	resources.List = append(resources.List, plan.added...)
+	return changes
+}
+
+// Function to work out the playlists an import creates or extends. folders maps a playlist
+// name to positions in the batch, ids holds the ID each of those resources ended up with.
+func planImportPlaylists(existing []Playlist, folders map[string][]int, ids []string) []playlistChange {
+	names := make([]string, 0, len(folders))
+	for name := range folders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes []playlistChange
+	for _, name := range names {
+		var members []string
+		for _, n := range folders[name] {
+			if id := ids[n]; id != "" && !containsFold(members, id) {
+				members = append(members, id)
+			}
+		}
+		i := findPlaylistByName(existing, name)
+		if i < 0 {
+			if len(members) > 0 {
+				p := Playlist{ID: uuid.New().String(), Name: name, ResourceIDs: members}
+				changes = append(changes, playlistChange{ID: p.ID, Index: -1, After: &p})
+			}
+			continue
+		}
+		before := existing[i]
+		after := before
+		after.ResourceIDs = append([]string{}, before.ResourceIDs...)
+		for _, id := range members {
+			if !containsFold(after.ResourceIDs, id) {
+				after.ResourceIDs = append(after.ResourceIDs, id)
+			}
+		}
+		if len(after.ResourceIDs) > len(before.ResourceIDs) {
+			changes = append(changes, playlistChange{ID: before.ID, Index: i, Before: &before, After: &after})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const journalFile = "history.json"
+
+// Only the most recent operations are kept, older ones can no longer be undone.
+const maxJournalEntries = 200
+
+// resourceChange is the state of one resource before and after an operation.
+// Before is nil for added resources and After is nil for deleted ones.
+type resourceChange struct {
+	ID     string    `json:"id"`
+	Index  int       `json:"index"` // position in the catalog before the change, -1 for new resources
+	Before *Resource `json:"before,omitempty"`
+	After  *Resource `json:"after,omitempty"`
+}
+
+// playlistChange is the state of one playlist before and after an operation.
+type playlistChange struct {
+	ID     string    `json:"id"`
+	Index  int       `json:"index"`
+	Before *Playlist `json:"before,omitempty"`
+	After  *Playlist `json:"after,omitempty"`
+}
+
+// journalEntry records one mutation made by a command.
+type journalEntry struct {
+	Time        string           `json:"time"`
+	Command     string           `json:"command"`
+	Description string           `json:"description"`
+	Resources   []resourceChange `json:"resources,omitempty"`
+	Playlists   []playlistChange `json:"playlists,omitempty"`
+}
+
+var (
+	errNothingToUndo = errors.New("nothing to undo")
+	errNothingToRedo = errors.New("nothing to redo")
+)
+
+// journal is the operation history. Entries[:Cursor] are applied,
+// the entries after the cursor were undone and can be redone.
+type journal struct {
+	Cursor  int            `json:"cursor"`
+	Entries []journalEntry `json:"entries"`
+}
+
+func journalStore() *jsonFile {
+	return &jsonFile{path: dataPath(journalFile)}
+}
+
+// Function to read the journal, a missing file is an empty history
+func loadJournal(f *jsonFile, j *journal) error {
+	if err := f.read(j); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Function to add an operation to the journal, dropping anything that was undone
+func recordOperation(entry journalEntry) {
+	if len(entry.Resources) == 0 && len(entry.Playlists) == 0 {
+		return
+	}
+	entry.Time = time.Now().Format(time.RFC3339)
+	f := journalStore()
+	err := withFileLock(f.path, func() error {
+		var j journal
+		if err := loadJournal(f, &j); err != nil {
+			return err
+		}
+		j.Entries = append(j.Entries[:j.Cursor], entry)
+		if len(j.Entries) > maxJournalEntries {
+			j.Entries = j.Entries[len(j.Entries)-maxJournalEntries:]
+		}
+		j.Cursor = len(j.Entries)
+		return f.write(j)
+	})
+	if err != nil {
+		color.Yellow("Warning: could not record this change in the undo history: %v", err)
+	}
+}
+
+// Function to record a single resource change
+func recordResourceChange(command, description string, change resourceChange) {
+	recordOperation(journalEntry{Command: command, Description: description, Resources: []resourceChange{change}})
+}
+
+// Function to record a single playlist change
+func recordPlaylistChange(command, description string, change playlistChange) {
+	recordOperation(journalEntry{Command: command, Description: description, Playlists: []playlistChange{change}})
+}
+
+// Function to undo the most recent operation
+func undoOperation() error {
+	return stepJournal(true)
+}
+
+// Function to redo the most recently undone operation
+func redoOperation() error {
+	return stepJournal(false)
+}
+
+// Function to move the journal cursor one step, applying the entry it passes over
+func stepJournal(undo bool) error {
+	f := journalStore()
+	var entry journalEntry
+	err := withFileLock(f.path, func() error {
+		var j journal
+		if err := loadJournal(f, &j); err != nil {
+			return err
+		}
+		if undo && j.Cursor == 0 {
+			return errNothingToUndo
+		}
+		if !undo && j.Cursor == len(j.Entries) {
+			return errNothingToRedo
+		}
+		if undo {
+			entry = j.Entries[j.Cursor-1]
+		} else {
+			entry = j.Entries[j.Cursor]
+		}
+		if err := applyJournalEntry(entry, undo); err != nil {
+			return err
+		}
+		if undo {
+			j.Cursor--
+		} else {
+			j.Cursor++
+		}
+		return f.write(j)
+	})
+	if err != nil {
+		return err
+	}
+	if undo {
+		color.Green("Undid %s: %s", entry.Command, entry.Description)
+	} else {
+		color.Green("Redid %s: %s", entry.Command, entry.Description)
+	}
+	return nil
+}
+
+// Function to bring resources and playlists back to the state before (undo) or after (redo) an entry.
+// It refuses if something was changed outside the journal since, instead of overwriting that change.
+func applyJournalEntry(entry journalEntry, undo bool) error {
+	if len(entry.Resources) > 0 {
+		resources, err := loadResources()
+		if err != nil {
+			return err
+		}
+		list := resources.List
+		changes := entry.Resources
+		for k := range changes {
+			c := changes[k]
+			if undo {
+				c = changes[len(changes)-1-k]
+			}
+			from, to := c.Before, c.After
+			if undo {
+				from, to = to, from
+			}
+			i := findResourceByID(list, c.ID)
+			if !sameJSON(resourceAt(list, i), from) {
+				return fmt.Errorf("resource %s was changed after this operation, not touching it", c.ID)
+			}
+			switch {
+			case to == nil:
+				list = append(list[:i], list[i+1:]...)
+			case i >= 0:
+				list[i] = *to
+			case c.Index >= 0 && c.Index <= len(list):
+				list = append(list[:c.Index], append([]Resource{*to}, list[c.Index:]...)...)
+			default:
+				list = append(list, *to)
+			}
+		}
+		resources.List = list
+		if err := saveResources(resources); err != nil {
+			return err
+		}
+	}
+
+	if len(entry.Playlists) > 0 {
+		playlists, err := loadPlaylists()
+		if err != nil {
+			return err
+		}
+		list := playlists.List
+		changes := entry.Playlists
+		for k := range changes {
+			c := changes[k]
+			if undo {
+				c = changes[len(changes)-1-k]
+			}
+			from, to := c.Before, c.After
+			if undo {
+				from, to = to, from
+			}
+			i := findPlaylistByID(list, c.ID)
+			var current *Playlist
+			if i >= 0 {
+				current = &list[i]
+			}
+			if !sameJSON(current, from) {
+				return fmt.Errorf("playlist %s was changed after this operation, not touching it", c.ID)
+			}
+			switch {
+			case to == nil:
+				list = append(list[:i], list[i+1:]...)
+			case i >= 0:
+				list[i] = *to
+			case c.Index >= 0 && c.Index <= len(list):
+				list = append(list[:c.Index], append([]Playlist{*to}, list[c.Index:]...)...)
+			default:
+				list = append(list, *to)
+			}
+		}
+		playlists.List = list
+		if err := savePlaylists(playlists); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to find a resource's position by ID, returns -1 if it isn't there
+func findResourceByID(resources []Resource, id string) int {
+	for i, r := range resources {
+		if strings.EqualFold(r.ID, id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Function to find a playlist's position by ID, returns -1 if it isn't there
+func findPlaylistByID(playlists []Playlist, id string) int {
+	for i, p := range playlists {
+		if strings.EqualFold(p.ID, id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Function to copy a playlist so later edits to its ID list don't change the copy
+func copyPlaylist(p Playlist) Playlist {
+	p.ResourceIDs = append([]string(nil), p.ResourceIDs...)
+	return p
+}
+
+func resourceAt(resources []Resource, i int) *Resource {
+	if i < 0 {
+		return nil
+	}
+	return &resources[i]
+}
+
+// Function to compare two records by how they are stored
+func sameJSON(a, b interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+// Function to show the operation history, newest first
+func showHistory() error {
+	f := journalStore()
+	var j journal
+	if err := loadJournal(f, &j); err != nil {
+		return fmt.Errorf("loading history: %w", err)
+	}
+	if len(j.Entries) == 0 {
+		color.Yellow("No history yet.")
+		return nil
+	}
+	for i := len(j.Entries) - 1; i >= 0; i-- {
+		e := j.Entries[i]
+		line := fmt.Sprintf("%s  %-20s %s", e.Time, e.Command, e.Description)
+		if i >= j.Cursor {
+			color.New(color.Faint).Printf("%s (undone)\n", line)
+		} else {
+			fmt.Println(line)
+		}
+	}
+	return nil
+}
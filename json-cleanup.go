@@ -26,7 +26,7 @@ func generateIDs(resources *Resources) {
 
 // Read the JSON file
 func updateIds() {
-	file, err := os.Open("resources.json")
+	file, err := os.Open(dataPath(resourcesFile))
 	if err != nil {
 		log.Fatalf("Error opening file: %v", err)
 	}
@@ -45,6 +45,11 @@ func updateIds() {
 		log.Fatalf("Error parsing JSON: %v", err)
 	}
 
+	// Renumbering touches every ID, so keep a copy of the catalog as it was
+	if _, err := takeBackup("update-ids"); err != nil {
+		log.Fatalf("Error taking a backup: %v", err)
+	}
+
 	// Generate IDs for resources
 	generateIDs(&resources)
 
@@ -55,7 +60,7 @@ func updateIds() {
 	}
 
 	// Write the updated JSON to a file
-	err = ioutil.WriteFile("resources_updated.json", updatedData, 0644)
+	err = ioutil.WriteFile(dataPath("resources_updated.json"), updatedData, 0644)
 	if err != nil {
 		log.Fatalf("Error writing to file: %v", err)
 	}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+var lenientLoad = flag.Bool("lenient", false, "skip malformed resources (they are moved to "+quarantineFile+") instead of failing")
+
+const quarantineFile = "resources.quarantine.json"
+
+// Only this many problems are spelled out in a load error, `check` lists all of them.
+const maxReportedProblems = 10
+
+// resourceProblem describes one malformed entry in the catalog file.
+type resourceProblem struct {
+	Offset  int64
+	Line    int
+	Column  int
+	ID      string
+	Message string
+	Raw     json.RawMessage
+}
+
+func (p resourceProblem) String() string {
+	id := "(no id)"
+	if p.ID != "" {
+		id = fmt.Sprintf("id %q", p.ID)
+	}
+	return fmt.Sprintf("line %d, column %d (offset %d), %s: %s", p.Line, p.Column, p.Offset, id, p.Message)
+}
+
+// errInvalidCatalog is returned by check when it found malformed entries.
+var errInvalidCatalog = errors.New("invalid catalog")
+
+// catalogError is returned by the strict loader when the catalog has malformed entries.
+type catalogError struct {
+	path     string
+	problems []resourceProblem
+}
+
+func (e *catalogError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s has %d malformed resource(s):", filepath.Base(e.path), len(e.problems))
+	for i, p := range e.problems {
+		if i == maxReportedProblems {
+			fmt.Fprintf(&b, "\n  ... and %d more (run `check` to list them all)", len(e.problems)-i)
+			break
+		}
+		fmt.Fprintf(&b, "\n  %s", p)
+	}
+	b.WriteString("\nFix them by hand, or start outgo with --lenient to skip them.")
+	return b.String()
+}
+
+// rawEntry is one undecoded element of a data file's list, with the byte offset it starts at.
+type rawEntry struct {
+	offset int64
+	raw    json.RawMessage
+}
+
+// Function to split the list stored under listKey into raw entries, remembering where each one starts
+func scanEntries(data []byte, listKey string) ([]rawEntry, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return nil, errors.New("expected a JSON object at the top level")
+	}
+
+	var entries []rawEntry
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key, _ := tok.(string); key != listKey {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		tok, err = dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if tok == nil {
+			continue // "resources": null
+		}
+		if d, ok := tok.(json.Delim); !ok || d != '[' {
+			return nil, fmt.Errorf("%q should be a list", listKey)
+		}
+		for dec.More() {
+			start := skipSeparators(data, dec.InputOffset())
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, err
+			}
+			entries = append(entries, rawEntry{offset: start, raw: raw})
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Function to move an offset past whitespace and the comma between two list elements
+func skipSeparators(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) {
+		switch data[offset] {
+		case ' ', '\t', '\r', '\n', ',':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// lineIndex finds line and column numbers in one file without rescanning it for every lookup.
+type lineIndex []int64 // offsets of the newlines
+
+func newLineIndex(data []byte) lineIndex {
+	var idx lineIndex
+	for i, b := range data {
+		if b == '\n' {
+			idx = append(idx, int64(i))
+		}
+	}
+	return idx
+}
+
+// Function to turn a byte offset into a 1-based line and column
+func (idx lineIndex) position(offset int64) (int, int) {
+	n := sort.Search(len(idx), func(i int) bool { return idx[i] >= offset })
+	if n == 0 {
+		return 1, int(offset) + 1
+	}
+	return n + 1, int(offset - idx[n-1])
+}
+
+// Function to add the line and column to JSON syntax errors
+func describeJSONError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line, column := newLineIndex(data).position(min(syntaxErr.Offset, int64(len(data))))
+		return fmt.Errorf("line %d, column %d (offset %d): %v", line, column, syntaxErr.Offset, err)
+	}
+	return err
+}
+
+// Function to decode the catalog one entry at a time, validating each resource.
+// original is the file as it is on disk and is used for positions, migrated is what gets decoded.
+// In strict mode any malformed entry fails the load with a *catalogError, in lenient mode
+// malformed entries are skipped and quarantined.
+func decodeCatalog(path string, original, migrated []byte, out *Resources, lenient bool) error {
+	base := filepath.Base(path)
+	origEntries, err := scanEntries(original, "resources")
+	if err != nil {
+		return fmt.Errorf("%s: %v", base, describeJSONError(original, err))
+	}
+	entries := origEntries
+	if !bytes.Equal(original, migrated) {
+		// Migrations work entry by entry, so element i still lines up with element i on disk
+		if entries, err = scanEntries(migrated, "resources"); err != nil {
+			return fmt.Errorf("%s: %v", base, err)
+		}
+	}
+
+	var header struct {
+		Version  int   `json:"version"`
+		EventSeq int64 `json:"event_seq"`
+	}
+	json.Unmarshal(migrated, &header)
+	out.Version = header.Version
+	out.EventSeq = header.EventSeq
+	out.List = make([]Resource, 0, len(entries))
+
+	lines := newLineIndex(original)
+	firstSeen := make(map[string]int)
+	var problems []resourceProblem
+	for i, e := range entries {
+		problem := func(id, msg string) {
+			line, column := lines.position(origEntries[i].offset)
+			problems = append(problems, resourceProblem{
+				Offset:  origEntries[i].offset,
+				Line:    line,
+				Column:  column,
+				ID:      id,
+				Message: msg,
+				Raw:     origEntries[i].raw,
+			})
+		}
+
+		var r Resource
+		if err := json.Unmarshal(e.raw, &r); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				problem(peekID(e.raw), fmt.Sprintf("field %q should be %s, not a JSON %s", typeErr.Field, typeErr.Type, typeErr.Value))
+			} else {
+				problem(peekID(e.raw), err.Error())
+			}
+			continue
+		}
+		switch key := strings.ToLower(r.ID); {
+		case resourceFault(r) != "":
+			problem(strings.TrimSpace(r.ID), resourceFault(r))
+		case firstSeen[key] != 0:
+			problem(r.ID, fmt.Sprintf("duplicate id, already used on line %d", firstSeen[key]))
+		default:
+			firstSeen[key], _ = lines.position(origEntries[i].offset)
+			out.List = append(out.List, r)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	if !lenient {
+		return &catalogError{path: path, problems: problems}
+	}
+	quarantinePath := filepath.Join(filepath.Dir(path), quarantineFile)
+	if err := quarantineResources(quarantinePath, base, problems); err != nil {
+		return fmt.Errorf("error quarantining malformed resources: %v", err)
+	}
+	color.Yellow("Skipped %d malformed resource(s) in %s, they were copied to %s", len(problems), base, quarantinePath)
+	return nil
+}
+
+// Function to say what makes a resource unusable, "" if nothing does
+func resourceFault(r Resource) string {
+	switch {
+	case strings.TrimSpace(r.ID) == "":
+		return "id is missing"
+	case strings.TrimSpace(r.Title) == "":
+		return "title is missing"
+	}
+	return ""
+}
+
+// Function to get the id of an entry that doesn't decode as a Resource, if it has a usable one
+func peekID(raw json.RawMessage) string {
+	var entry struct {
+		ID interface{} `json:"id"`
+	}
+	json.Unmarshal(raw, &entry)
+	id, _ := entry.ID.(string)
+	return id
+}
+
+type quarantineEntry struct {
+	Source        string          `json:"source"`
+	Error         string          `json:"error"`
+	QuarantinedAt string          `json:"quarantined_at"`
+	Entry         json.RawMessage `json:"entry"`
+}
+
+type quarantine struct {
+	Entries []quarantineEntry `json:"entries"`
+}
+
+// Function to append skipped entries to the quarantine file, leaving out ones already in it
+func quarantineResources(path, source string, problems []resourceProblem) error {
+	return withFileLock(path, func() error {
+		var q quarantine
+		if data, err := ioutil.ReadFile(path); err == nil {
+			if err := json.Unmarshal(data, &q); err != nil {
+				return fmt.Errorf("%s: %v", filepath.Base(path), err)
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		known := make(map[string]bool)
+		for _, e := range q.Entries {
+			known[compactJSON(e.Entry)] = true
+		}
+		added := false
+		for _, p := range problems {
+			if known[compactJSON(p.Raw)] {
+				continue
+			}
+			q.Entries = append(q.Entries, quarantineEntry{
+				Source:        fmt.Sprintf("%s:%d:%d", source, p.Line, p.Column),
+				Error:         p.Message,
+				QuarantinedAt: time.Now().Format(time.RFC3339),
+				Entry:         p.Raw,
+			})
+			added = true
+		}
+		if !added {
+			return nil
+		}
+		data, err := json.MarshalIndent(q, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(path, data, 0644)
+	})
+}
+
+// Function to normalize JSON so the same entry compares equal however it was indented
+func compactJSON(raw json.RawMessage) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, raw); err != nil {
+		return string(raw)
+	}
+	return b.String()
+}
+
+// Function to validate the catalog file and list every malformed entry. With the event
+// store the logs are replayed and checked first, a data directory with only a log is fine.
+func checkCatalog() error {
+	if db, ok := store.(*sqliteStore); ok {
+		problems, count, err := db.checkResources()
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			fmt.Printf("  %s\n", p)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("%w: the database has %d malformed resource(s)", errInvalidCatalog, len(problems))
+		}
+		color.Green("All %d resources in the database are valid.", count)
+		return nil
+	}
+	path := dataPath(resourcesFile)
+	if events, ok := store.(*eventStore); ok {
+		problems, count, err := events.checkLogs()
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			fmt.Printf("  %s\n", p)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("%w: the event log has %d problem(s)", errInvalidCatalog, len(problems))
+		}
+		color.Green("All %d events in %s and %s replay cleanly.", count, eventsArchiveFile, eventsFile)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		}
+	}
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	migrated, _, err := migrateData(original, "resources", resourceMigrations)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, describeJSONError(original, err))
+	}
+
+	var resources Resources
+	err = decodeCatalog(path, original, migrated, &resources, false)
+	var catErr *catalogError
+	switch {
+	case errors.As(err, &catErr):
+		for _, p := range catErr.problems {
+			fmt.Printf("  %s\n", p)
+		}
+		return fmt.Errorf("%w: %s has %d malformed resource(s)", errInvalidCatalog, resourcesFile, len(catErr.problems))
+	case err != nil:
+		return err
+	}
+	color.Green("All %d resources in %s are valid.", len(resources.List), resourcesFile)
+	return nil
+}
@@ -2,9 +2,9 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"math/rand"
 	"os"
 	"strings"
@@ -25,20 +25,34 @@ type Resource struct {
 	Link   string   `json:"link"`
 	Tags   []string `json:"tags"`
 	Author string   `json:"author,omitempty"`
+	ISBN   string   `json:"isbn,omitempty"`
+	Rating int      `json:"rating,omitempty"` // 1 to 5 stars, 0 if not rated
+	// When it was added or bookmarked, RFC 3339 in UTC. Older resources don't have it.
+	AddedAt string `json:"added_at,omitempty"`
+	// Podcast episodes: the show's resource ID, the length in seconds, when it came
+	// out (RFC 3339 in UTC) and the audio file.
+	Show      string `json:"show,omitempty"`
+	Duration  int    `json:"duration,omitempty"`
+	Published string `json:"published,omitempty"`
+	Enclosure string `json:"enclosure,omitempty"`
 }
 
 type Resources struct {
-	List []Resource `json:"resources"`
+	Version  int        `json:"version"`
+	EventSeq int64      `json:"event_seq,omitempty"` // last event log entry included, see eventStore
+	List     []Resource `json:"resources"`
 }
 
 type Playlist struct {
-	ID        string     `json:id`
-	Name      string     `json:"name"`
-	Resources []Resource `json:"resources"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	ResourceIDs []string `json:"resource_ids"`
 }
 
 type Playlists struct {
-	List []Playlist `json:"playlists"`
+	Version  int        `json:"version"`
+	EventSeq int64      `json:"event_seq,omitempty"`
+	List     []Playlist `json:"playlists"`
 }
 
 const (
@@ -48,6 +62,9 @@ const (
 
 const itemsPerPage = 20
 
+// The shared Google Sheet, the source fetch-updates reads until sources.json lists others.
+const updatesSheetID = "1wganKHEJps87WhFI2O_xyVw-3vkTshmaf665OKczbwc"
+
 // Colors for genres, statuses, and tags
 var genreColors = map[string]color.Attribute{
 	"self-improvement": color.FgGreen,
@@ -75,14 +92,24 @@ var tagColors = map[string]color.Attribute{
 }
 
 var resourceFields = map[string]bool{
-	"ID":     true,
-	"Title":  true,
-	"Genre":  true,
-	"Type":   false,
-	"Status": false,
-	"Tags":   false,
+	"ID":        true,
+	"Title":     true,
+	"Author":    false,
+	"Genre":     true,
+	"Type":      false,
+	"Status":    false,
+	"Tags":      false,
+	"ISBN":      false,
+	"Rating":    false,
+	"Added":     false,
+	"Show":      false,
+	"Duration":  false,
+	"Published": false,
 }
 
+// The order resource columns are shown in, resourceFields is a map and has none.
+var resourceFieldOrder = []string{"ID", "Title", "Author", "Genre", "Type", "Status", "Tags", "ISBN", "Rating", "Added", "Show", "Duration", "Published"}
+
 var playlistFields = map[string]bool{
 	"Name":      true,
 	"Resources": true,
@@ -90,39 +117,19 @@ var playlistFields = map[string]bool{
 }
 
 func loadResources() (Resources, error) {
-	var resources Resources
-	file, err := ioutil.ReadFile(resourcesFile)
-	if err != nil {
-		return resources, err
-	}
-	err = json.Unmarshal(file, &resources)
-	return resources, err
+	return catalog.LoadResources()
 }
 
 func saveResources(resources Resources) error {
-	data, err := json.MarshalIndent(resources, "", "  ")
-	if err != nil {
-		return err
-	}
-	return ioutil.WriteFile(resourcesFile, data, 0644)
+	return catalog.SaveResources(resources)
 }
 
 func loadPlaylists() (Playlists, error) {
-	var playlists Playlists
-	file, err := ioutil.ReadFile(playlistsFile)
-	if err != nil {
-		return playlists, err
-	}
-	err = json.Unmarshal(file, &playlists)
-	return playlists, err
+	return catalog.LoadPlaylists()
 }
 
 func savePlaylists(playlists Playlists) error {
-	data, err := json.MarshalIndent(playlists, "", "  ")
-	if err != nil {
-		return err
-	}
-	return ioutil.WriteFile(playlistsFile, data, 0644)
+	return catalog.SavePlaylists(playlists)
 }
 
 func addResource(reader *bufio.Reader) {
@@ -163,94 +170,111 @@ func addResource(reader *bufio.Reader) {
 		resource.Author = strings.TrimSpace(resource.Author)
 	}
 
-	resources, err := loadResources()
-	if err != nil {
-		color.Red("Error loading resources: %v", err)
-		return
-	}
-
-	resources.List = append(resources.List, resource)
-	err = saveResources(resources)
-	if err != nil {
+	if _, err := putResource(resource); err != nil {
 		color.Red("Error saving resources: %v", err)
 	} else {
 		color.Green("Resource added successfully!")
 	}
 }
 
+// Function to add a resource, replacing the one with the same ID, and record it for undo
+func putResource(resource Resource) (replaced bool, err error) {
+	existing, i, err := catalog.Lookup(resource.ID)
+	if err != nil {
+		return false, err
+	}
+	// Adding an existing ID replaces that resource, so remember what was there for undo
+	change := resourceChange{ID: resource.ID, Index: i, After: &resource}
+	if i >= 0 {
+		change.Before = &existing
+	}
+	if _, err := catalog.Put(resource); err != nil {
+		return false, err
+	}
+	recordResourceChange("add", fmt.Sprintf("added %s", resource.ID), change)
+	return i >= 0, nil
+}
+
 func deleteResource(reader *bufio.Reader) {
-	fmt.Print("Enter ID of resource to delete: ")
-	id, _ := reader.ReadString('\n')
-	id = strings.TrimSpace(id)
+	id := promptResourceID(reader, "Enter ID of resource to delete (?words to search): ")
 
-	resources, err := loadResources()
+	resource, i, err := findResourceOrSuggest(reader, id)
 	if err != nil {
 		color.Red("Error loading resources: %v", err)
 		return
 	}
+	if i < 0 {
+		return
+	}
 
-	for i, resource := range resources.List {
-		if strings.EqualFold(resource.ID, id) {
-			resources.List = append(resources.List[:i], resources.List[i+1:]...)
-			err := saveResources(resources)
-			if err != nil {
-				color.Red("Error saving resources: %v", err)
-			} else {
-				color.Green("Deleted resource: %s", id)
-			}
-			return
-		}
+	if _, err := removeResource(resource.ID); err != nil {
+		color.Red("Error saving resources: %v", err)
+		return
 	}
-	color.Yellow("Resource with ID %s not found.", id)
+	color.Green("Deleted resource: %s", resource.ID)
 }
 
-func filterResources(reader *bufio.Reader) {
-	fmt.Print("Enter filter criteria (genre/tag/status): ")
-	criteria, _ := reader.ReadString('\n')
-	criteria = strings.TrimSpace(criteria)
-
-	fmt.Printf("Enter %s to filter by: ", criteria)
-	value, _ := reader.ReadString('\n')
-	value = strings.TrimSpace(value)
+// Function to delete a resource by ID and record it for undo
+func removeResource(id string) (Resource, error) {
+	resource, i, err := catalog.Lookup(id)
+	if err != nil {
+		return Resource{}, err
+	}
+	if i < 0 {
+		return Resource{}, fmt.Errorf("%w: %s", errResourceNotFound, id)
+	}
+	if err := catalog.Delete(resource.ID); err != nil {
+		return Resource{}, err
+	}
+	recordResourceChange("delete", fmt.Sprintf("deleted %s", resource.ID),
+		resourceChange{ID: resource.ID, Index: i, Before: &resource})
+	return resource, nil
+}
 
-	resources, err := loadResources()
+func filterResources(reader *bufio.Reader, args []string) {
+	args, order, err := extractSortFlag(args)
 	if err != nil {
-		color.Red("Error loading resources: %v", err)
+		color.Red("Error: %v", err)
+		return
+	}
+	args, format, err := extractFormatFlag(args)
+	if err != nil {
+		color.Red("Error: %v", err)
+		return
+	}
+	query := strings.Join(args, " ")
+	if query == "" {
+		fmt.Print("Enter filter query (e.g. genre:tech AND status:unread -type:book): ")
+		query, _ = reader.ReadString('\n')
+		query = strings.TrimSpace(query)
+	}
+	if query == "" {
+		color.Red("Enter a query to filter by, see `help`.")
 		return
 	}
 
 	filtered := Resources{}
-	for _, r := range resources.List {
-		switch criteria {
-		case "genre":
-			if strings.EqualFold(r.Genre, value) {
-				filtered.List = append(filtered.List, r)
-			}
-		case "tag":
-			for _, tag := range r.Tags {
-				if strings.EqualFold(tag, value) {
-					filtered.List = append(filtered.List, r)
-					break
-				}
-			}
-		case "status":
-			if strings.EqualFold(r.Status, value) {
-				filtered.List = append(filtered.List, r)
-			}
-		default:
-			color.Red("Unknown filter criteria: %s", criteria)
-			return
-		}
+	filtered.List, err = runQuery(query)
+	if err != nil {
+		reportQueryError(err)
+		return
 	}
+	filtered.List = sortResources(filtered.List, order)
 
+	if format != formatTable {
+		if err := writeResources(os.Stdout, format, filtered.List); err != nil {
+			reportError(err)
+		}
+		return
+	}
 	if len(filtered.List) == 0 {
-		color.Yellow("No resources found for %s: %s", criteria, value)
+		color.Yellow("No resources match %s", query)
 		return
 	}
 
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"ID", "Title", "Type", "Genre", "Status"})
-	table.SetColumnColor(tablewriter.Colors{tablewriter.Bold}, tablewriter.Colors{tablewriter.Bold}, tablewriter.Colors{tablewriter.Bold}, tablewriter.Colors{tablewriter.Bold}, tablewriter.Colors{tablewriter.Bold})
+	setColumnColors(table, tablewriter.Colors{tablewriter.Bold}, tablewriter.Colors{tablewriter.Bold}, tablewriter.Colors{tablewriter.Bold}, tablewriter.Colors{tablewriter.Bold}, tablewriter.Colors{tablewriter.Bold})
 
 	for _, r := range filtered.List {
 		table.Append([]string{r.ID, r.Title, r.Type, r.Genre, r.Status})
@@ -260,33 +284,46 @@ func filterResources(reader *bufio.Reader) {
 }
 
 func markResourceStatus(reader *bufio.Reader) {
-	fmt.Print("Enter ID of resource to mark: ")
-	id, _ := reader.ReadString('\n')
-	id = strings.TrimSpace(id)
+	id := promptResourceID(reader, "Enter ID of resource to mark (?words to search): ")
+
+	resource, i, err := findResourceOrSuggest(reader, id)
+	if err != nil {
+		color.Red("Error loading resources: %v", err)
+		return
+	}
+	if i < 0 {
+		return
+	}
 
 	fmt.Print("Enter new status (unread/viewed/in progress/not started): ")
 	status, _ := reader.ReadString('\n')
 	status = strings.TrimSpace(status)
 
-	resources, err := loadResources()
-	if err != nil {
-		color.Red("Error loading resources: %v", err)
+	if _, err := setResourceStatus(resource.ID, status); err != nil {
+		color.Red("Error saving resources: %v", err)
 		return
 	}
+	color.Green("Updated status of resource: %s to %s", resource.ID, status)
+}
 
-	for i, resource := range resources.List {
-		if strings.EqualFold(resource.ID, id) {
-			resources.List[i].Status = status
-			err := saveResources(resources)
-			if err != nil {
-				color.Red("Error saving resources: %v", err)
-			} else {
-				color.Green("Updated status of resource: %s to %s", id, status)
-			}
-			return
-		}
+// Function to change a resource's status and record it for undo, returns the resource as it was
+func setResourceStatus(id, status string) (Resource, error) {
+	resource, i, err := catalog.Lookup(id)
+	if err != nil {
+		return Resource{}, err
 	}
-	color.Yellow("Resource with ID %s not found.", id)
+	if i < 0 {
+		return Resource{}, fmt.Errorf("%w: %s", errResourceNotFound, id)
+	}
+	before := resource
+	before.Tags = append([]string(nil), resource.Tags...)
+	resource.Status = status
+	if _, err := catalog.Put(resource); err != nil {
+		return Resource{}, err
+	}
+	recordResourceChange("mark", fmt.Sprintf("marked %s as %s (was %s)", resource.ID, status, before.Status),
+		resourceChange{ID: resource.ID, Index: i, Before: &before, After: &resource})
+	return before, nil
 }
 
 func createPlaylist(reader *bufio.Reader) {
@@ -294,46 +331,67 @@ func createPlaylist(reader *bufio.Reader) {
 	name, _ := reader.ReadString('\n')
 	name = strings.TrimSpace(name)
 
-	// Generate a unique ID for the playlist
-	playlistID := uuid.New().String()
+	var resourceIDs []string
 
-	playlists, err := loadPlaylists()
-	if err != nil {
-		color.Red("Error loading playlists: %v", err)
-		return
+	fmt.Print("Add every resource matching a query (or press Enter to pick them one by one): ")
+	query, _ := reader.ReadString('\n')
+	if query = strings.TrimSpace(query); query != "" {
+		matches, err := runQuery(query)
+		if err != nil {
+			reportQueryError(err)
+			return
+		}
+		for _, r := range matches {
+			resourceIDs = append(resourceIDs, r.ID)
+		}
+		color.Cyan("Added %d matching resource(s).", len(matches))
 	}
 
-	playlist := Playlist{ID: playlistID, Name: name}
 	for {
-		fmt.Print("Enter resource ID to add to playlist (or 'done' to finish): ")
-		id, _ := reader.ReadString('\n')
-		id = strings.TrimSpace(id)
+		id := promptResourceID(reader, "Enter resource ID to add to playlist (?words to search, 'done' to finish): ")
 
 		if strings.EqualFold(id, "done") {
 			break
 		}
 
-		resources, err := loadResources()
+		resource, i, err := findResourceOrSuggest(reader, id)
 		if err != nil {
 			color.Red("Error loading resources: %v", err)
 			return
 		}
-
-		for _, resource := range resources.List {
-			if strings.EqualFold(resource.ID, id) {
-				playlist.Resources = append(playlist.Resources, resource)
-				break
-			}
+		if i >= 0 {
+			resourceIDs = append(resourceIDs, resource.ID)
 		}
 	}
 
-	playlists.List = append(playlists.List, playlist)
-	err = savePlaylists(playlists)
+	playlist, err := newPlaylist(name, resourceIDs)
 	if err != nil {
 		color.Red("Error saving playlists: %v", err)
 	} else {
-		color.Green("Playlist '%s' created successfully with ID: %s !", name, playlistID)
+		color.Green("Playlist '%s' created successfully with ID: %s !", name, playlist.ID)
+	}
+}
+
+// Function to create a playlist with a new ID and record it for undo
+func newPlaylist(name string, resourceIDs []string) (Playlist, error) {
+	// Generate a unique ID for the playlist
+	playlist := Playlist{ID: uuid.New().String(), Name: name, ResourceIDs: resourceIDs}
+	if err := catalog.PutPlaylist(playlist); err != nil {
+		return Playlist{}, err
+	}
+	recordPlaylistChange("create-playlist", fmt.Sprintf("created playlist '%s'", name),
+		playlistChange{ID: playlist.ID, Index: -1, After: &playlist})
+	return playlist, nil
+}
+
+// Function to find a playlist by name, the position is -1 if there is none
+func findPlaylistByName(playlists []Playlist, name string) int {
+	for i, p := range playlists {
+		if strings.EqualFold(p.Name, name) {
+			return i
+		}
 	}
+	return -1
 }
 
 func addResourceToPlaylist(reader *bufio.Reader) {
@@ -341,41 +399,60 @@ func addResourceToPlaylist(reader *bufio.Reader) {
 	playlistName, _ := reader.ReadString('\n')
 	playlistName = strings.TrimSpace(playlistName)
 
-	fmt.Print("Enter resource ID to add to playlist: ")
-	resourceID, _ := reader.ReadString('\n')
-	resourceID = strings.TrimSpace(resourceID)
-
-	playlists, err := loadPlaylists()
+	playlists, err := catalog.Playlists()
 	if err != nil {
 		color.Red("Error loading playlists: %v", err)
 		return
 	}
+	if findPlaylistByName(playlists, playlistName) < 0 {
+		color.Yellow("Playlist with name %s not found.", playlistName)
+		return
+	}
 
-	for i, playlist := range playlists.List {
-		if strings.EqualFold(playlist.Name, playlistName) {
-			resources, err := loadResources()
-			if err != nil {
-				color.Red("Error loading resources: %v", err)
-				return
-			}
+	resourceID := promptResourceID(reader, "Enter resource ID to add to playlist (?words to search): ")
+	resource, j, err := findResourceOrSuggest(reader, resourceID)
+	if err != nil {
+		color.Red("Error loading resources: %v", err)
+		return
+	}
+	if j < 0 {
+		return
+	}
 
-			for _, resource := range resources.List {
-				if strings.EqualFold(resource.ID, resourceID) {
-					playlists.List[i].Resources = append(playlists.List[i].Resources, resource)
-					err := savePlaylists(playlists)
-					if err != nil {
-						color.Red("Error saving playlists: %v", err)
-					} else {
-						color.Green("Added resource %s to playlist '%s'", resourceID, playlistName)
-					}
-					return
-				}
-			}
-			color.Yellow("Resource with ID %s not found.", resourceID)
-			return
-		}
+	if _, err := addToPlaylist(playlistName, resource.ID); err != nil {
+		color.Red("Error saving playlists: %v", err)
+		return
 	}
-	color.Yellow("Playlist with name %s not found.", playlistName)
+	color.Green("Added resource %s to playlist '%s'", resource.ID, playlistName)
+}
+
+// Function to append a resource to a playlist found by name and record it for undo
+func addToPlaylist(playlistName, resourceID string) (Playlist, error) {
+	playlists, err := loadPlaylists()
+	if err != nil {
+		return Playlist{}, err
+	}
+	i := findPlaylistByName(playlists.List, playlistName)
+	if i < 0 {
+		return Playlist{}, fmt.Errorf("%w: %s", errPlaylistNotFound, playlistName)
+	}
+	resource, j, err := catalog.Lookup(resourceID)
+	if err != nil {
+		return Playlist{}, err
+	}
+	if j < 0 {
+		return Playlist{}, fmt.Errorf("%w: %s", errResourceNotFound, resourceID)
+	}
+
+	playlist := playlists.List[i]
+	before := copyPlaylist(playlist)
+	playlist.ResourceIDs = append(playlist.ResourceIDs, resource.ID)
+	if err := catalog.PutPlaylist(playlist); err != nil {
+		return Playlist{}, err
+	}
+	recordPlaylistChange("add-to-playlist", fmt.Sprintf("added %s to playlist '%s'", resource.ID, playlist.Name),
+		playlistChange{ID: playlist.ID, Index: i, Before: &before, After: &playlist})
+	return playlist, nil
 }
 
 func removeResourceFromPlaylist(reader *bufio.Reader) {
@@ -383,35 +460,77 @@ func removeResourceFromPlaylist(reader *bufio.Reader) {
 	playlistName, _ := reader.ReadString('\n')
 	playlistName = strings.TrimSpace(playlistName)
 
-	fmt.Print("Enter resource ID to remove from playlist: ")
-	resourceID, _ := reader.ReadString('\n')
-	resourceID = strings.TrimSpace(resourceID)
-
-	playlists, err := loadPlaylists()
+	playlists, err := catalog.Playlists()
 	if err != nil {
 		color.Red("Error loading playlists: %v", err)
 		return
 	}
+	i := findPlaylistByName(playlists, playlistName)
+	if i < 0 {
+		color.Yellow("Playlist with name %s not found.", playlistName)
+		return
+	}
+	list, err := catalog.Resources()
+	if err != nil {
+		color.Red("Error loading resources: %v", err)
+		return
+	}
+	// Only the playlist's own resources are offered, dangling IDs too so they can be taken out
+	members, missing := resolvePlaylist(playlists[i], Resources{List: list})
+	for _, id := range missing {
+		members = append(members, Resource{ID: id})
+	}
+	suggest := func(query string, limit int) ([]Resource, error) {
+		return suggestAmong(query, members, limit), nil
+	}
 
-	for i, playlist := range playlists.List {
-		if strings.EqualFold(playlist.Name, playlistName) {
-			for j, r := range playlist.Resources {
-				if strings.EqualFold(r.ID, resourceID) {
-					playlists.List[i].Resources = append(playlists.List[i].Resources[:j], playlists.List[i].Resources[j+1:]...)
-					err := savePlaylists(playlists)
-					if err != nil {
-						color.Red("Error saving playlists: %v", err)
-					} else {
-						color.Green("Removed resource %s from playlist '%s'", resourceID, playlistName)
-					}
-					return
-				}
+	resourceID := promptResourceIDFrom(reader, "Enter resource ID to remove from playlist (?words to search): ", suggest)
+	if resourceID == "" {
+		return
+	}
+	resource, ok := findAmongOrSuggest(reader, resourceID, members, "in playlist "+playlists[i].Name)
+	if !ok {
+		return
+	}
+
+	_, err = removeFromPlaylist(playlistName, resource.ID)
+	switch {
+	case errors.Is(err, errPlaylistNotFound):
+		color.Yellow("Playlist with name %s not found.", playlistName)
+	case errors.Is(err, errResourceNotFound):
+		color.Yellow("Resource with ID %s not found in playlist %s.", resource.ID, playlistName)
+	case err != nil:
+		color.Red("Error saving playlists: %v", err)
+	default:
+		color.Green("Removed resource %s from playlist '%s'", resource.ID, playlistName)
+	}
+}
+
+// Function to take a resource out of a playlist found by name and record it for undo
+func removeFromPlaylist(playlistName, resourceID string) (Playlist, error) {
+	playlists, err := loadPlaylists()
+	if err != nil {
+		return Playlist{}, err
+	}
+	i := findPlaylistByName(playlists.List, playlistName)
+	if i < 0 {
+		return Playlist{}, fmt.Errorf("%w: %s", errPlaylistNotFound, playlistName)
+	}
+
+	playlist := playlists.List[i]
+	for j, id := range playlist.ResourceIDs {
+		if strings.EqualFold(id, resourceID) {
+			before := copyPlaylist(playlist)
+			playlist.ResourceIDs = append(playlist.ResourceIDs[:j], playlist.ResourceIDs[j+1:]...)
+			if err := catalog.PutPlaylist(playlist); err != nil {
+				return Playlist{}, err
 			}
-			color.Yellow("Resource with ID %s not found in playlist %s.", resourceID, playlistName)
-			return
+			recordPlaylistChange("remove-from-playlist", fmt.Sprintf("removed %s from playlist '%s'", id, playlist.Name),
+				playlistChange{ID: playlist.ID, Index: i, Before: &before, After: &playlist})
+			return playlist, nil
 		}
 	}
-	color.Yellow("Playlist with name %s not found.", playlistName)
+	return Playlist{}, fmt.Errorf("%w in playlist %s: %s", errResourceNotFound, playlist.Name, resourceID)
 }
 
 func toggleField(fields map[string]bool, field string) {
@@ -438,89 +557,180 @@ func showFieldOptions(fields map[string]bool) {
 }
 
 // Function to list resources with pagination
-func listResources() {
-	resources, err := loadResources()
+func listResources(args []string) {
+	args, order, err := extractSortFlag(args)
 	if err != nil {
-		color.Red("Error loading resources: %v", err)
+		color.Red("Error: %v", err)
+		return
+	}
+	args, format, err := extractFormatFlag(args)
+	if err != nil {
+		color.Red("Error: %v", err)
+		return
+	}
+	resources, err := runQuery(strings.Join(args, " "))
+	if err != nil {
+		reportQueryError(err)
 		return
 	}
 
-	if len(resources.List) == 0 {
+	if format != formatTable {
+		if err := writeResources(os.Stdout, format, sortResources(resources, order)); err != nil {
+			reportError(err)
+		}
+		return
+	}
+	if len(resources) == 0 {
 		color.Yellow("No resources found.")
 		return
 	}
+	showResourcePages(resources, nil, order)
+}
 
-	totalPages := (len(resources.List) + itemsPerPage - 1) / itemsPerPage
-	currentPage := 0
-
-	for {
-		start := currentPage * itemsPerPage
-		end := start + itemsPerPage
-		if end > len(resources.List) {
-			end = len(resources.List)
+// Function to color one cell of the resource table. decorate, when set, can replace
+// a value, e.g. to highlight search matches; it reports whether it changed anything.
+func resourceCell(field, value string, decorate func(field, value string) (string, bool)) string {
+	if decorate != nil {
+		if decorated, ok := decorate(field, value); ok {
+			return decorated
 		}
+	}
+	switch field {
+	case "Genre":
+		return color.New(genreColors[value]).Sprint(value)
+	case "Status":
+		return color.New(statusColors[value]).Sprint(value)
+	case "Tags":
+		return color.New(tagColors[value]).Sprint(value)
+	}
+	return value
+}
 
-		table := tablewriter.NewWriter(os.Stdout)
-		table.SetAutoFormatHeaders(false)
-		table.SetRowLine(true) // Adds a line between each row
+// Function to show a rating as stars, empty when there is none
+func ratingText(rating int) string {
+	if rating <= 0 {
+		return ""
+	}
+	return strings.Repeat("★", min(rating, 5))
+}
 
-		var headers []string
-		var columnColors []tablewriter.Colors
+// Function to show a length in seconds as 1:02:03, or 45:10 under an hour
+func durationText(seconds int) string {
+	if seconds <= 0 {
+		return ""
+	}
+	if seconds < 3600 {
+		return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
 
-		// Prepare headers and column colors
-		for field, visible := range resourceFields {
-			if visible {
-				headers = append(headers, field)
-				columnColors = append(columnColors, tablewriter.Colors{tablewriter.FgWhiteColor}) // Default color
-			}
+// Function to show when a resource was added (or published) as a local date
+func addedDate(addedAt string) string {
+	t, err := time.Parse(time.RFC3339, addedAt)
+	if err != nil {
+		return addedAt
+	}
+	return t.Local().Format("2006-01-02")
+}
+
+// Function to build a table row from the visible fields, in resourceFieldOrder
+func resourceRow(r Resource, decorate func(field, value string) (string, bool)) []string {
+	var row []string
+	for _, field := range resourceFieldOrder {
+		if !resourceFields[field] {
+			continue
 		}
-		table.SetHeader(headers)
-		table.SetColumnColor(columnColors...)
-
-		for _, r := range resources.List[start:end] {
-			// Ensure headers and columns are aligned
-			var row []string
-			if resourceFields["ID"] {
-				row = append(row, r.ID)
-			}
-			if resourceFields["Title"] {
-				row = append(row, r.Title)
-			}
-			if resourceFields["Genre"] {
-				genreColor := genreColors[r.Genre]
-				row = append(row, color.New(genreColor).Sprintf(r.Genre))
-			}
-			if resourceFields["Type"] {
-				row = append(row, r.Type)
-			}
-			if resourceFields["Status"] {
-				statusColor := statusColors[r.Status]
-				row = append(row, color.New(statusColor).Sprintf(r.Status))
-			}
-			if resourceFields["Tags"] {
-				var tagStrings []string
-				for _, tag := range r.Tags {
-					tagColor := tagColors[tag]
-					tagStrings = append(tagStrings, color.New(tagColor).Sprintf(tag))
-				}
-				row = append(row, strings.Join(tagStrings, ", "))
+		switch field {
+		case "ID":
+			row = append(row, resourceCell(field, r.ID, decorate))
+		case "Title":
+			row = append(row, resourceCell(field, r.Title, decorate))
+		case "Author":
+			row = append(row, resourceCell(field, r.Author, decorate))
+		case "Genre":
+			row = append(row, resourceCell(field, r.Genre, decorate))
+		case "Type":
+			row = append(row, resourceCell(field, r.Type, decorate))
+		case "Status":
+			row = append(row, resourceCell(field, r.Status, decorate))
+		case "Tags":
+			var tagStrings []string
+			for _, tag := range r.Tags {
+				tagStrings = append(tagStrings, resourceCell(field, tag, decorate))
 			}
+			row = append(row, strings.Join(tagStrings, ", "))
+		case "ISBN":
+			row = append(row, resourceCell(field, r.ISBN, decorate))
+		case "Rating":
+			row = append(row, resourceCell(field, ratingText(r.Rating), decorate))
+		case "Added":
+			row = append(row, resourceCell(field, addedDate(r.AddedAt), decorate))
+		case "Show":
+			row = append(row, resourceCell(field, r.Show, decorate))
+		case "Duration":
+			row = append(row, resourceCell(field, durationText(r.Duration), decorate))
+		case "Published":
+			row = append(row, resourceCell(field, addedDate(r.Published), decorate))
+		}
+	}
+	return row
+}
 
-			// Check if row length matches header length
-			if len(row) != len(headers) {
-				fmt.Println("Row length doesn't match header length!")
-				continue
-			}
+// Function to render resources as one table with the visible fields
+func renderResourceTable(resources []Resource, decorate func(field, value string) (string, bool)) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoFormatHeaders(false)
+	table.SetRowLine(true) // Adds a line between each row
 
-			table.Append(row)
+	var headers []string
+	var columnColors []tablewriter.Colors
+
+	// Prepare headers and column colors
+	for _, field := range resourceFieldOrder {
+		if resourceFields[field] {
+			headers = append(headers, field)
+			columnColors = append(columnColors, tablewriter.Colors{tablewriter.FgWhiteColor}) // Default color
 		}
+	}
+	table.SetHeader(headers)
+	setColumnColors(table, columnColors...)
 
-		fmt.Print("\033[38;5;201m") // Set text color to light magenta (pink tone)
-		table.Render()
-		fmt.Print("\033[0m") // Reset text color here
+	for _, r := range resources {
+		table.Append(resourceRow(r, decorate))
+	}
 
-		fmt.Printf("Page %d of %d\n", currentPage+1, totalPages)
-		fmt.Println("Options: [1] Go Left, [2] Go Right, [3] Return to Previous Screen")
+	ansi("\033[38;5;201m") // Set text color to light magenta (pink tone)
+	table.Render()
+	ansi("\033[0m") // Reset text color here
+}
+
+// Function to show resources in pages of itemsPerPage, used by list and search
+// The sort order applies to all of them and stays while paging, it can be changed from the page menu.
+func showResourcePages(resources []Resource, decorate func(field, value string) (string, bool), order sortSpec) {
+	totalPages := (len(resources) + itemsPerPage - 1) / itemsPerPage
+	currentPage := 0
+	unsorted := resources
+	resources = sortResources(unsorted, order)
+
+	for {
+		start := currentPage * itemsPerPage
+		end := start + itemsPerPage
+		if end > len(resources) {
+			end = len(resources)
+		}
+
+		renderResourceTable(resources[start:end], decorate)
+
+		if totalPages == 1 {
+			return
+		}
+		if len(order) > 0 {
+			fmt.Printf("Page %d of %d, sorted by %s\n", currentPage+1, totalPages, order)
+		} else {
+			fmt.Printf("Page %d of %d\n", currentPage+1, totalPages)
+		}
+		fmt.Println("Options: [1] Go Left, [2] Go Right, [3] Return to Previous Screen, [4] Sort")
 
 		choice := getUserChoice()
 		switch choice {
@@ -534,20 +744,63 @@ func listResources() {
 			}
 		case "3":
 			return
+		case "4":
+			fmt.Printf("Sort by (e.g. title,-author; keys: %s): ", strings.Join(sortKeyNames(), ", "))
+			spec, _ := stdin.ReadString('\n')
+			parsed, err := parseSortSpec(spec)
+			if err != nil {
+				color.Red("Error: %v", err)
+				continue
+			}
+			order = parsed
+			resources = sortResources(unsorted, order)
+			currentPage = 0
 		default:
 			color.Red("Invalid choice. Please try again.")
 		}
 	}
 }
 
+// Function to render playlists as one table
+func renderPlaylistTable(playlists []Playlist) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoFormatHeaders(false)
+	table.SetRowLine(true)
+
+	table.SetHeader([]string{"ID", "Name"})
+	setColumnColors(table,
+		tablewriter.Colors{tablewriter.FgWhiteColor},
+		tablewriter.Colors{tablewriter.FgWhiteColor},
+	)
+
+	for _, p := range playlists {
+		table.Append([]string{p.ID, p.Name})
+	}
+
+	ansi("\033[32m") // Set text color to green
+	table.Render()
+	ansi("\033[0m") // Reset text color
+}
+
 // Function to list playlists with pagination
-func listPlaylists() {
+func listPlaylists(args []string) {
+	_, format, err := extractFormatFlag(args)
+	if err != nil {
+		color.Red("Error: %v", err)
+		return
+	}
 	playlists, err := loadPlaylists()
 	if err != nil {
 		color.Red("Error loading playlists: %v", err)
 		return
 	}
 
+	if format != formatTable {
+		if err := writePlaylists(os.Stdout, format, playlists.List); err != nil {
+			reportError(err)
+		}
+		return
+	}
 	if len(playlists.List) == 0 {
 		color.Yellow("No playlists found.")
 		return
@@ -563,24 +816,11 @@ func listPlaylists() {
 			end = len(playlists.List)
 		}
 
-		table := tablewriter.NewWriter(os.Stdout)
-		table.SetAutoFormatHeaders(false)
-		table.SetRowLine(true)
-
-		table.SetHeader([]string{"ID", "Name"})
-		table.SetColumnColor(
-			tablewriter.Colors{tablewriter.FgWhiteColor},
-			tablewriter.Colors{tablewriter.FgWhiteColor},
-		)
+		renderPlaylistTable(playlists.List[start:end])
 
-		for _, p := range playlists.List[start:end] {
-			table.Append([]string{p.ID, p.Name})
+		if totalPages == 1 {
+			return
 		}
-
-		fmt.Print("\033[32m") // Set text color to green
-		table.Render()
-		fmt.Print("\033[0m") // Reset text color
-
 		fmt.Printf("Page %d of %d\n", currentPage+1, totalPages)
 		fmt.Println("Options: [1] Go Left, [2] Go Right, [3] Return to Previous Screen")
 
@@ -603,29 +843,34 @@ func listPlaylists() {
 }
 
 // Function to get a random resource
-func getRandomResource() {
-	resources, err := loadResources()
+func getRandomResource(args []string) {
+	resources, err := runQuery(strings.Join(args, " "))
 	if err != nil {
-		color.Red("Error loading resources: %v", err)
+		reportQueryError(err)
 		return
 	}
 
-	if len(resources.List) == 0 {
+	if len(resources) == 0 {
 		color.Yellow("No resources found.")
 		return
 	}
 
 	rand.Seed(time.Now().UnixNano())
-	randomIndex := rand.Intn(len(resources.List))
-	randomResource := resources.List[randomIndex]
+	randomIndex := rand.Intn(len(resources))
+	randomResource := resources[randomIndex]
 
 	color.Green("Random Resource: %s (ID: %s)", randomResource.Title, randomResource.ID)
 }
 
-// Function to get user choice
+// stdin is shared by every prompt, a second reader on os.Stdin would miss what this one buffered.
+var stdin = bufio.NewReader(os.Stdin)
+
+// Function to get user choice, at the end of the input it picks "3" to leave the menu
 func getUserChoice() string {
-	var choice string
-	fmt.Scan(&choice)
+	choice, err := stdin.ReadString('\n')
+	if choice = strings.TrimSpace(choice); choice == "" && err != nil {
+		return "3"
+	}
 	return choice
 }
 
@@ -643,10 +888,40 @@ func fieldOptions(reader *bufio.Reader, fields map[string]bool) {
 	}
 }
 
-func viewPlaylistByID(reader *bufio.Reader) {
-	fmt.Print("Enter playlist ID: ")
-	playlistID, _ := reader.ReadString('\n')
-	playlistID = strings.TrimSpace(playlistID)
+// Function to look up a playlist's resources in the catalog.
+// IDs that no longer exist in the catalog are returned as missing.
+func resolvePlaylist(playlist Playlist, resources Resources) (found []Resource, missing []string) {
+	byID := make(map[string]Resource, len(resources.List))
+	for _, r := range resources.List {
+		byID[strings.ToLower(r.ID)] = r
+	}
+	for _, id := range playlist.ResourceIDs {
+		if r, ok := byID[strings.ToLower(id)]; ok {
+			found = append(found, r)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return found, missing
+}
+
+func viewPlaylistByID(reader *bufio.Reader, args []string) {
+	args, order, err := extractSortFlag(args)
+	if err != nil {
+		color.Red("Error: %v", err)
+		return
+	}
+	args, format, err := extractFormatFlag(args)
+	if err != nil {
+		color.Red("Error: %v", err)
+		return
+	}
+	playlistID := strings.Join(args, " ")
+	if playlistID == "" {
+		fmt.Print("Enter playlist ID: ")
+		playlistID, _ = reader.ReadString('\n')
+		playlistID = strings.TrimSpace(playlistID)
+	}
 
 	playlists, err := loadPlaylists()
 	if err != nil {
@@ -656,94 +931,45 @@ func viewPlaylistByID(reader *bufio.Reader) {
 
 	for _, playlist := range playlists.List {
 		if strings.EqualFold(playlist.ID, playlistID) {
+			if format != formatTable {
+				resources, err := loadResources()
+				if err != nil {
+					color.Red("Error loading resources: %v", err)
+					return
+				}
+				found, missing := resolvePlaylist(playlist, resources)
+				for _, id := range missing {
+					fmt.Fprintln(color.Error, color.YellowString("Resource %s is no longer in the catalog.", id))
+				}
+				if err := writeResources(os.Stdout, format, sortResources(found, order)); err != nil {
+					reportError(err)
+				}
+				return
+			}
+
 			// Display playlist name and ID
 			color.Cyan("Playlist: %s\n", playlist.Name)
 			color.Yellow("ID: %s\n", playlist.ID)
 
 			// Render resources in the playlist
-			if len(playlist.Resources) == 0 {
+			if len(playlist.ResourceIDs) == 0 {
 				color.Red("No resources in this playlist.")
 				return
 			}
 
-			table := tablewriter.NewWriter(os.Stdout)
-			table.SetAutoFormatHeaders(false)
-			table.SetRowLine(true)
-
-			// Prepare headers and column colors based on the visibility in resourceFields
-			var headers []string
-			var columnColors []tablewriter.Colors
-
-			if resourceFields["ID"] {
-				headers = append(headers, "Resource ID")
-				columnColors = append(columnColors, tablewriter.Colors{tablewriter.FgWhiteColor})
-			}
-			if resourceFields["Title"] {
-				headers = append(headers, "Title")
-				columnColors = append(columnColors, tablewriter.Colors{tablewriter.FgWhiteColor})
-			}
-			if resourceFields["Genre"] {
-				headers = append(headers, "Genre")
-				columnColors = append(columnColors, tablewriter.Colors{tablewriter.FgWhiteColor})
-			}
-			if resourceFields["Type"] {
-				headers = append(headers, "Type")
-				columnColors = append(columnColors, tablewriter.Colors{tablewriter.FgWhiteColor})
-			}
-			if resourceFields["Status"] {
-				headers = append(headers, "Status")
-				columnColors = append(columnColors, tablewriter.Colors{tablewriter.FgWhiteColor})
-			}
-			if resourceFields["Tags"] {
-				headers = append(headers, "Tags")
-				columnColors = append(columnColors, tablewriter.Colors{tablewriter.FgWhiteColor})
+			// Resolve the playlist's IDs against the current catalog
+			resources, err := loadResources()
+			if err != nil {
+				color.Red("Error loading resources: %v", err)
+				return
 			}
-
-			// Set the headers and column colors in the table
-			table.SetHeader(headers)
-			table.SetColumnColor(columnColors...)
-
-			// Loop through resources and color fields like Genre, Status, and Tags based on resourceFields visibility
-			for _, resource := range playlist.Resources {
-				var row []string
-
-				if resourceFields["ID"] {
-					row = append(row, resource.ID)
-				}
-				if resourceFields["Title"] {
-					row = append(row, resource.Title)
-				}
-				if resourceFields["Genre"] {
-					genreColor := genreColors[resource.Genre]
-					coloredGenre := color.New(genreColor).Sprintf(resource.Genre)
-					row = append(row, coloredGenre)
-				}
-				if resourceFields["Type"] {
-					row = append(row, resource.Type)
-				}
-				if resourceFields["Status"] {
-					statusColor := statusColors[resource.Status]
-					coloredStatus := color.New(statusColor).Sprintf(resource.Status)
-					row = append(row, coloredStatus)
-				}
-				if resourceFields["Tags"] {
-					var tagStrings []string
-					for _, tag := range resource.Tags {
-						tagColor := tagColors[tag]
-						tagStrings = append(tagStrings, color.New(tagColor).Sprintf(tag))
-					}
-					coloredTags := strings.Join(tagStrings, ", ")
-					row = append(row, coloredTags)
-				}
-
-				// Append the row to the table
-				table.Append(row)
+			found, missing := resolvePlaylist(playlist, resources)
+			found = sortResources(found, order)
+			for _, id := range missing {
+				color.Yellow("Resource %s is no longer in the catalog.", id)
 			}
 
-			// Render the table with colored data
-			fmt.Print("\033[38;5;117m") // Set to light blue
-			table.Render()
-			fmt.Print("\033[0m") // Reset text color here
+			renderResourceTable(found, nil)
 			return
 		}
 	}
@@ -754,68 +980,169 @@ func printHelp() {
 	color.Cyan(`
 Available Commands:
 - add: Add a new resource
-- list: List all resources
+- list [query] [--sort title,-author] [--format json]: List all resources, or the ones matching a query
 - delete: Delete a resource
-- fetch-updates: Fetch the newest resources
-- filter: Filter resources by genre or tag
+- fetch-updates [--source name] [--dry-run]: Sync with every enabled source: add new resources and update changed ones, keeping their status. Shows the changes first, to accept, reject or pick
+- sources [list|add|remove|enable|disable]: Manage the sheets, CSV files and feeds fetch-updates reads (sources -h for details)
+- subscribe <feed-url> [--name n] [--genre g] [--tags a,b]: Follow an RSS or Atom feed, its new entries come in with fetch-updates
+- filter [query] [--sort keys] [--format f]: Filter resources, e.g. genre:tech AND (tag:ai OR author:"Hunt") -type:book
+- search [words] [--format f]: Search titles, authors, tags and genres, best matches first
 - mark: Mark a resource as read/viewed/etc.
 - create-playlist: Create a new playlist
-- list-playlists: List all playlists
-- view-playlist: Inspect a specific playlist from its id. 
+- list-playlists [--format f]: List all playlists
+- view-playlist [id] [--sort keys] [--format f]: Inspect a specific playlist from its id. 
 - add-to-playlist: Add a resource to a playlist
 - remove-from-playlist: Remove a resource from a playlist
+- undo: Undo the last change to resources or playlists
+- redo: Redo the last undone change
+- history: Show the changes that can be undone
+- events [count]: Show the latest entries of the event log
+- compact: Write fresh snapshots from the event log
+- rebuild --as-of <time> [--apply]: Show or restore the state at a past time
+- backups: List the automatic backups taken before bulk changes
+- restore <#|snapshot>: Show what would change and roll back to a backup
+- check: Validate resources.json and list malformed entries
+- migrate [--dry-run]: Upgrade resources.json and playlists.json to the current format
 - filter-fields: Toggle fields for listing resources
 - filter-playlist-fields: Toggle fields for listing playlists
-- random-resource: Get a single random resource
+- import <csv|goodreads|bookmarks|bibtex|podcast> <file> [flags]: Import resources from a file, with a preview before anything is saved (import -h for the formats)
+- episodes <show-id> [--unlistened]: List a podcast's episodes, mark one as listened with mark <id> --status viewed
+- export <goodreads|bibtex> [file] [flags]: Export the catalog for another tool, to stdout without a file (export -h for the formats)
+- random-resource [query]: Get a single random resource, optionally one matching a query
 - help: Show this help message
 - update: Fetch and add new resources from YouTube or similar sources
-- exit: Exit the application`)
+- exit: Exit the application
+--format is one of table, json, jsonl, csv, tsv, markdown or yaml and prints the visible fields (see filter-fields).
+Every command also runs without the prompt, e.g. outgo mark tech001 --status viewed (see outgo help).`)
 	color.Green(`Credits:
 - Developed by Atilla Colak
 - Special thanks to the Go community for inspiration and support.`)
 }
 
+// Function to set up the data directory and open the store, once per run
+func openSession() error {
+	if store != nil {
+		return nil
+	}
+	if err := setupDataDir(); err != nil {
+		return fmt.Errorf("setting up data directory: %w", err)
+	}
+	var err error
+	store, err = openStore(*storeBackend)
+	if err != nil {
+		return fmt.Errorf("opening %s store: %w", *storeBackend, err)
+	}
+	return nil
+}
+
 func main() {
-	reader := bufio.NewReader(os.Stdin)
+	flag.Parse()
+
+	// `outgo <command> ...` runs a single command for scripts, see cli.go
+	if flag.NArg() > 0 {
+		os.Exit(runCLI(flag.Args()))
+	}
+
+	if err := openSession(); err != nil {
+		reportError(err)
+		os.Exit(exitCode(err))
+	}
+	defer store.Close()
+
+	reader := stdin
 	printHelp() // Show help on startup
 
 	for {
 		fmt.Print("\nEnter command: ")
-		command, _ := reader.ReadString('\n')
-		command = strings.TrimSpace(command)
+		command, err := reader.ReadString('\n')
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			if err != nil {
+				// End of input, e.g. Ctrl-D or a piped script
+				fmt.Println()
+				return
+			}
+			continue
+		}
+		command, args := fields[0], fields[1:]
 
 		switch command {
 		case "add":
 			addResource(reader)
 		case "list":
-			listResources()
+			listResources(args)
 		case "delete":
 			deleteResource(reader)
 		case "fetch-updates":
-			sheetURL := "1wganKHEJps87WhFI2O_xyVw-3vkTshmaf665OKczbwc"
-			if err := updateResourcesWithType(sheetURL); err != nil {
-				fmt.Printf("Error updating resources from Google Sheets: %v\n", err)
+			if err := runCommand(command, args); err != nil && !errors.Is(err, flag.ErrHelp) {
+				reportError(fmt.Errorf("fetching updates: %w", err))
 			}
 		case "filter":
-			filterResources(reader)
+			filterResources(reader, args)
+		case "search":
+			searchResources(reader, args)
 		case "mark":
 			markResourceStatus(reader)
 		case "create-playlist":
 			createPlaylist(reader)
 		case "list-playlists":
-			listPlaylists()
+			listPlaylists(args)
 		case "view-playlist":
-			viewPlaylistByID(reader)
+			viewPlaylistByID(reader, args)
 		case "add-to-playlist":
 			addResourceToPlaylist(reader)
 		case "remove-from-playlist":
 			removeResourceFromPlaylist(reader)
+		case "undo":
+			if err := undoOperation(); err != nil {
+				reportError(err)
+			}
+		case "redo":
+			if err := redoOperation(); err != nil {
+				reportError(err)
+			}
+		case "history":
+			if err := showHistory(); err != nil {
+				reportError(err)
+			}
+		case "events":
+			if err := showEvents(args); err != nil {
+				reportError(err)
+			}
+		case "compact":
+			if err := compactEvents(); err != nil {
+				reportError(err)
+			}
+		case "rebuild":
+			if err := rebuildAsOf(args); err != nil {
+				reportError(err)
+			}
+		case "backups":
+			if err := showBackups(); err != nil {
+				reportError(err)
+			}
+		case "restore":
+			if err := restoreBackup(reader, args); err != nil {
+				reportError(err)
+			}
+		case "check":
+			if err := checkCatalog(); err != nil {
+				reportError(err)
+			}
+		case "migrate":
+			if err := migrateFiles(args); err != nil {
+				reportError(err)
+			}
 		case "filter-fields":
 			fieldOptions(reader, resourceFields)
 		case "filter-playlist-fields":
 			fieldOptions(reader, playlistFields)
 		case "random-resource":
-			getRandomResource()
+			getRandomResource(args)
+		case "import", "export", "sources", "subscribe", "episodes":
+			if err := runCommand(command, args); err != nil && !errors.Is(err, flag.ErrHelp) {
+				reportError(err)
+			}
 		case "help", "?":
 			printHelp()
 		case "exit", "quit":
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// migration upgrades a single resource or playlist entry by one schema version.
+// upgrade returns true if it changed the entry. Migrations must be safe to run
+// on entries that are already upgraded, because the SQLite store replays the
+// whole chain on rows whose version it doesn't track.
+type migration struct {
+	description string
+	upgrade     func(entry map[string]interface{}) bool
+}
+
+// resourceMigrations[i] upgrades resources.json from version i to i+1.
+var resourceMigrations = []migration{
+	{
+		description: "normalize entries written by the book/article scrapers and the updater",
+		upgrade:     normalizeResourceEntry,
+	},
+}
+
+// playlistMigrations[i] upgrades playlists.json from version i to i+1.
+var playlistMigrations = []migration{
+	{
+		description: `rename the "ID" key to "id"`,
+		upgrade: func(entry map[string]interface{}) bool {
+			id, ok := entry["ID"]
+			if !ok {
+				return false
+			}
+			delete(entry, "ID")
+			if _, exists := entry["id"]; !exists {
+				entry["id"] = id
+			}
+			return true
+		},
+	},
+	{
+		description: "replace embedded resource copies with resource IDs",
+		upgrade: func(entry map[string]interface{}) bool {
+			embedded, ok := entry["resources"]
+			if !ok {
+				return false
+			}
+			delete(entry, "resources")
+			ids, _ := entry["resource_ids"].([]interface{})
+			list, _ := embedded.([]interface{})
+			for _, item := range list {
+				if r, ok := item.(map[string]interface{}); ok {
+					if id, ok := r["id"].(string); ok && id != "" {
+						ids = append(ids, id)
+					}
+				}
+			}
+			entry["resource_ids"] = ids
+			return true
+		},
+	},
+}
+
+var (
+	resourcesSchemaVersion = len(resourceMigrations)
+	playlistsSchemaVersion = len(playlistMigrations)
+)
+
+// Function to bring a resource written by an older writer in line with the Resource struct.
+// Books were saved with "category" instead of "genre" and without a type, articles with an
+// empty type, and neither had a status.
+func normalizeResourceEntry(entry map[string]interface{}) bool {
+	changed := false
+	if category, ok := entry["category"]; ok {
+		if genre, _ := entry["genre"].(string); genre == "" {
+			entry["genre"] = category
+		}
+		delete(entry, "category")
+		changed = true
+	}
+	if t, ok := entry["type"].(string); !ok {
+		entry["type"] = "book"
+		changed = true
+	} else if t == "" {
+		entry["type"] = "article"
+		changed = true
+	}
+	if status, _ := entry["status"].(string); status == "" {
+		entry["status"] = "unread"
+		changed = true
+	}
+	if entry["tags"] == nil {
+		entry["tags"] = []interface{}{}
+		changed = true
+	}
+	if author, ok := entry["author"].(string); ok && author == "" {
+		delete(entry, "author")
+		changed = true
+	}
+	return changed
+}
+
+// migrationStep reports what one migration did to a file.
+type migrationStep struct {
+	from, to    int
+	description string
+	changed     int
+}
+
+// Function to upgrade a whole data file (a top-level object holding a list of entries under listKey).
+// Returns the upgraded JSON, or the input unchanged if it is already current.
+func migrateData(data []byte, listKey string, chain []migration) ([]byte, []migrationStep, error) {
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, nil, err
+	}
+	if header.Version > len(chain) {
+		return nil, nil, fmt.Errorf("file has schema version %d but this outgo only knows up to %d; please upgrade outgo", header.Version, len(chain))
+	}
+	if header.Version == len(chain) {
+		return data, nil, nil
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	list, _ := doc[listKey].([]interface{})
+	var steps []migrationStep
+	for v := header.Version; v < len(chain); v++ {
+		step := migrationStep{from: v, to: v + 1, description: chain[v].description}
+		for _, item := range list {
+			if entry, ok := item.(map[string]interface{}); ok && chain[v].upgrade(entry) {
+				step.changed++
+			}
+		}
+		steps = append(steps, step)
+	}
+	doc["version"] = len(chain)
+
+	migrated, err := json.Marshal(doc)
+	return migrated, steps, err
+}
+
+// Function to run the whole migration chain on one JSON encoded entry
+func migrateEntry(data []byte, chain []migration) ([]byte, bool, error) {
+	var entry map[string]interface{}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, err
+	}
+	changed := false
+	for _, m := range chain {
+		if m.upgrade(entry) {
+			changed = true
+		}
+	}
+	if !changed {
+		return data, false, nil
+	}
+	migrated, err := json.Marshal(entry)
+	return migrated, true, err
+}
+
+// Function to show (and unless dryRun, apply) the pending migrations of the JSON data files
+func migrateFiles(args []string) error {
+	dryRun := false
+	for _, arg := range args {
+		switch arg {
+		case "--dry-run", "-n":
+			dryRun = true
+		default:
+			return usageErrorf("unknown option for migrate: %s", arg)
+		}
+	}
+	if _, ok := jsonFiles(); !ok {
+		color.Yellow("The %s store upgrades its data automatically when it is opened.", *storeBackend)
+		return nil
+	}
+
+	files := []struct {
+		path    string
+		listKey string
+		chain   []migration
+	}{
+		{dataPath(resourcesFile), "resources", resourceMigrations},
+		{dataPath(playlistsFile), "playlists", playlistMigrations},
+	}
+
+	pending := 0
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f.path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", f.path, err)
+		}
+		_, steps, err := migrateData(data, f.listKey, f.chain)
+		if err != nil {
+			return fmt.Errorf("migrating %s: %w", f.path, err)
+		}
+		if len(steps) == 0 {
+			color.Green("%s is up to date (version %d).", f.path, len(f.chain))
+			continue
+		}
+		pending++
+		color.Cyan("%s: version %d -> %d", f.path, steps[0].from, len(f.chain))
+		for _, step := range steps {
+			fmt.Printf("  v%d -> v%d: %s (%d entries changed)\n", step.from, step.to, step.description, step.changed)
+		}
+	}
+
+	// Playlists may point at resources that were deleted before they referenced them by ID
+	resources, rerr := loadResources()
+	playlists, perr := loadPlaylists()
+	if rerr == nil && perr == nil {
+		for _, p := range playlists.List {
+			if _, missing := resolvePlaylist(p, resources); len(missing) > 0 {
+				color.Yellow("Playlist '%s' references resources that are not in the catalog: %s", p.Name, strings.Join(missing, ", "))
+			}
+		}
+	}
+
+	if pending == 0 || dryRun {
+		if dryRun && pending > 0 {
+			color.Yellow("Dry run: nothing was written.")
+		}
+		return nil
+	}
+	if rerr != nil {
+		return fmt.Errorf("loading resources: %w", rerr)
+	}
+	if perr != nil {
+		return fmt.Errorf("loading playlists: %w", perr)
+	}
+	if err := backupBefore("migrate"); err != nil {
+		return err
+	}
+	if es, ok := store.(*eventStore); ok {
+		// The snapshots only change on compaction, so write them now in the new format
+		if err := es.Compact(); err != nil {
+			return fmt.Errorf("writing snapshots: %w", err)
+		}
+		color.Green("Data files migrated.")
+		return nil
+	}
+	if err := saveResources(resources); err != nil {
+		return fmt.Errorf("saving resources: %w", err)
+	}
+	if err := savePlaylists(playlists); err != nil {
+		return fmt.Errorf("saving playlists: %w", err)
+	}
+	color.Green("Data files migrated.")
+	return nil
+}
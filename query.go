@@ -0,0 +1,376 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// Query language used by filter, list, random-resource and create-playlist:
+//
+//	query   = or
+//	or      = and { "OR" and }
+//	and     = unary { ["AND"] unary }       two terms next to each other mean AND
+//	unary   = ("NOT" | "-") unary | primary
+//	primary = "(" query ")" | field ":" value | value
+//	value   = word | "quoted string"
+//
+// genre, status, type, tag, id, isbn, rating and show match the whole value ignoring case, title,
+// author and link match any part of it, and a bare value matches any part of
+// the title, author, genre or one of the tags.
+
+// The fields a query can name, and what they are matched against.
+var queryFields = map[string]func(Resource) []string{
+	"id":     func(r Resource) []string { return []string{r.ID} },
+	"title":  func(r Resource) []string { return []string{r.Title} },
+	"author": func(r Resource) []string { return []string{r.Author} },
+	"genre":  func(r Resource) []string { return []string{r.Genre} },
+	"status": func(r Resource) []string { return []string{r.Status} },
+	"type":   func(r Resource) []string { return []string{r.Type} },
+	"tag":    func(r Resource) []string { return r.Tags },
+	"link":   func(r Resource) []string { return []string{r.Link} },
+	"isbn":   func(r Resource) []string { return []string{r.ISBN} },
+	"rating": func(r Resource) []string { return []string{strconv.Itoa(r.Rating)} },
+	"show":   func(r Resource) []string { return []string{r.Show} },
+}
+
+// Fields matched on a part of the value instead of the whole of it.
+var queryContainsFields = map[string]bool{"title": true, "author": true, "link": true}
+
+// ParseError is a query that can't be parsed, Pos is the byte offset of the problem.
+type ParseError struct {
+	Query string
+	Pos   int
+	Msg   string
+}
+
+func (e *ParseError) Error() string {
+	column := len([]rune(e.Query[:e.Pos]))
+	return fmt.Sprintf("column %d: %s\n  %s\n  %s^", column+1, e.Msg, e.Query, strings.Repeat(" ", column))
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokColon
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+	tokMinus
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// Function to split a query into tokens
+func lexQuery(query string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == ':':
+			tokens = append(tokens, token{tokColon, ":", i})
+			i++
+		case c == '-' && (i == 0 || strings.ContainsRune(" \t(", rune(query[i-1]))):
+			// Only a leading minus negates, "self-improvement" is one word
+			tokens = append(tokens, token{tokMinus, "-", i})
+			i++
+		case c == '"':
+			start := i
+			var b strings.Builder
+			i++
+			for i < len(query) && query[i] != '"' {
+				if query[i] == '\\' && i+1 < len(query) {
+					i++
+				}
+				b.WriteByte(query[i])
+				i++
+			}
+			if i == len(query) {
+				return nil, &ParseError{query, start, "unterminated quoted string"}
+			}
+			i++
+			tokens = append(tokens, token{tokString, b.String(), start})
+		default:
+			start := i
+			for i < len(query) && !strings.ContainsRune(" \t():\"", rune(query[i])) {
+				i++
+			}
+			word := query[start:i]
+			kind := tokWord
+			switch word {
+			case "AND":
+				kind = tokAnd
+			case "OR":
+				kind = tokOr
+			case "NOT":
+				kind = tokNot
+			}
+			tokens = append(tokens, token{kind, word, start})
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(query)}), nil
+}
+
+// queryNode is one node of a parsed query.
+type queryNode interface {
+	match(r Resource) bool
+	String() string
+}
+
+type andNode struct{ left, right queryNode }
+type orNode struct{ left, right queryNode }
+type notNode struct{ operand queryNode }
+
+// fieldNode matches one field, e.g. genre:tech.
+type fieldNode struct{ field, value string }
+
+// textNode is a bare value, matched against the title, author, genre and tags.
+type textNode struct{ value string }
+
+func (n andNode) match(r Resource) bool { return n.left.match(r) && n.right.match(r) }
+func (n orNode) match(r Resource) bool  { return n.left.match(r) || n.right.match(r) }
+func (n notNode) match(r Resource) bool { return !n.operand.match(r) }
+
+func (n fieldNode) match(r Resource) bool {
+	for _, v := range queryFields[n.field](r) {
+		if queryContainsFields[n.field] {
+			if strings.Contains(strings.ToLower(v), strings.ToLower(n.value)) {
+				return true
+			}
+		} else if strings.EqualFold(v, n.value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n textNode) match(r Resource) bool {
+	value := strings.ToLower(n.value)
+	for _, v := range append([]string{r.Title, r.Author, r.Genre}, r.Tags...) {
+		if strings.Contains(strings.ToLower(v), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n andNode) String() string   { return "(" + n.left.String() + " AND " + n.right.String() + ")" }
+func (n orNode) String() string    { return "(" + n.left.String() + " OR " + n.right.String() + ")" }
+func (n notNode) String() string   { return "NOT " + n.operand.String() }
+func (n fieldNode) String() string { return n.field + ":" + quoteQueryValue(n.value) }
+func (n textNode) String() string  { return quoteQueryValue(n.value) }
+
+func quoteQueryValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " \t():\"") || v == "AND" || v == "OR" || v == "NOT" {
+		return `"` + strings.ReplaceAll(strings.ReplaceAll(v, `\`, `\\`), `"`, `\"`) + `"`
+	}
+	return v
+}
+
+type queryParser struct {
+	query  string
+	tokens []token
+	pos    int
+}
+
+// Function to parse a query into a tree that can be matched against resources
+func parseQuery(query string) (queryNode, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{query: query, tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, p.errorf(p.peek(), "empty query")
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		if t.kind == tokRParen {
+			return nil, p.errorf(t, "unmatched )")
+		}
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	return node, nil
+}
+
+func (p *queryParser) peek() token { return p.tokens[p.pos] }
+
+func (p *queryParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) errorf(t token, format string, args ...interface{}) error {
+	return &ParseError{Query: p.query, Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case tokAnd:
+			p.next()
+		case tokWord, tokString, tokLParen, tokNot, tokMinus:
+			// Implicit AND
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if k := p.peek().kind; k == tokNot || k == tokMinus {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.peek(); closing.kind != tokRParen {
+			return nil, p.errorf(closing, "missing ) to close the ( at column %d", len([]rune(p.query[:t.pos]))+1)
+		}
+		p.next()
+		return node, nil
+	case tokString:
+		return textNode{t.text}, nil
+	case tokWord:
+		if p.peek().kind != tokColon {
+			return textNode{t.text}, nil
+		}
+		field := strings.ToLower(t.text)
+		if field == "tags" {
+			field = "tag"
+		}
+		if _, ok := queryFields[field]; !ok {
+			return nil, p.errorf(t, "unknown field %q, use one of %s", t.text, strings.Join(queryFieldNames(), ", "))
+		}
+		p.next() // the colon
+		value := p.next()
+		if value.kind != tokWord && value.kind != tokString {
+			return nil, p.errorf(value, "expected a value after %s:", t.text)
+		}
+		return fieldNode{field, value.text}, nil
+	case tokEOF:
+		return nil, p.errorf(t, "query ends too early")
+	default:
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+}
+
+func queryFieldNames() []string {
+	var names []string
+	for name := range queryFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Function to get the resources matching a parsed query, in catalog order.
+// A single indexed field:value is answered from the index.
+func (c *Catalog) Query(q queryNode) ([]Resource, error) {
+	if f, ok := q.(fieldNode); ok {
+		for _, indexed := range catalogIndexes {
+			if f.field == indexed {
+				return c.Filter(f.field, f.value)
+			}
+		}
+	}
+	resources, err := c.Resources()
+	if err != nil {
+		return nil, err
+	}
+	var matches []Resource
+	for _, r := range resources {
+		if q.match(r) {
+			matches = append(matches, r)
+		}
+	}
+	return matches, nil
+}
+
+// Function to parse a query typed by the user and run it, an empty query matches everything
+func runQuery(query string) ([]Resource, error) {
+	if strings.TrimSpace(query) == "" {
+		return catalog.Resources()
+	}
+	q, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return catalog.Query(q)
+}
+
+// Function to print why a query couldn't be run
+func reportQueryError(err error) {
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		color.Red("Invalid query: %v", parseErr)
+		return
+	}
+	color.Red("Error loading resources: %v", err)
+}
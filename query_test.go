@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseQueryPrecedence(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"go", "go"},
+		{"a b", "(a AND b)"},
+		{"a AND b OR c", "((a AND b) OR c)"},
+		{"a OR b AND c", "(a OR (b AND c))"},
+		{"a OR b c", "(a OR (b AND c))"},
+		{"a OR b OR c", "((a OR b) OR c)"},
+		{"NOT a b", "(NOT a AND b)"},
+		{"-a OR b", "(NOT a OR b)"},
+		{"NOT NOT a", "NOT NOT a"},
+		{"(a OR b) c", "((a OR b) AND c)"},
+		{"-(a OR b)", "NOT (a OR b)"},
+		{"self-improvement", "self-improvement"},
+		{"Genre:tech tags:go", "(genre:tech AND tag:go)"},
+		{`title:"deep work" OR "AND"`, `(title:"deep work" OR "AND")`},
+		{`"say \"hi\""`, `"say \"hi\""`},
+	}
+	for _, tt := range tests {
+		node, err := parseQuery(tt.query)
+		if err != nil {
+			t.Errorf("parseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		if got := node.String(); got != tt.want {
+			t.Errorf("parseQuery(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+		msg   string
+	}{
+		{"", 0, "empty query"},
+		{"   ", 3, "empty query"},
+		{"a OR", 4, "query ends too early"},
+		{"NOT", 3, "query ends too early"},
+		{"(a OR b", 7, "missing ) to close the ( at column 1"},
+		{"x (a", 4, "missing ) to close the ( at column 3"},
+		{"a)", 1, "unmatched )"},
+		{"a OR )", 5, `unexpected ")"`},
+		{`title:"open`, 6, "unterminated quoted string"},
+		{"colour:red", 0, `unknown field "colour"`},
+		{"genre:", 6, "expected a value after genre:"},
+		{"genre:(tech)", 6, "expected a value after genre:"},
+		{"(a) :b", 4, `unexpected ":"`},
+	}
+	for _, tt := range tests {
+		_, err := parseQuery(tt.query)
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("parseQuery(%q) = %v, want a ParseError", tt.query, err)
+			continue
+		}
+		if perr.Pos != tt.pos || !strings.HasPrefix(perr.Msg, tt.msg) {
+			t.Errorf("parseQuery(%q) failed at %d with %q, want %d with %q", tt.query, perr.Pos, perr.Msg, tt.pos, tt.msg)
+		}
+	}
+}
+
+func TestParseErrorColumnCountsRunes(t *testing.T) {
+	_, err := parseQuery("café )")
+	want := "column 6: unmatched )\n  café )\n       ^"
+	if err == nil || err.Error() != want {
+		t.Errorf("error is %q, want %q", err, want)
+	}
+}
@@ -2,9 +2,7 @@ package main
 
 // THIS IS FOR SCRAPING AI/ML ARTICLES:
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"os"
 	"strings"
@@ -22,19 +20,21 @@ type Article struct {
 	Type     string   `json:"type"`
 }
 
-// Define a struct to match the resources.json format
-type ResourceFileArticle struct {
-	Resources []Article `json:"resources"`
-}
-
-// Function to check if the article already exists in the JSON
-func articleExists(articles []Article, title string) bool {
-	for _, article := range articles {
-		if article.Title == title {
-			return true
-		}
+// Function to convert a scraped article into a catalog entry
+func (a Article) toResource() Resource {
+	resource := Resource{
+		Title:  a.Title,
+		Type:   a.Type,
+		Genre:  a.Category,
+		Status: "unread",
+		Link:   a.Link,
+		Tags:   a.Tags,
+		Author: a.Author,
 	}
-	return false
+	if resource.Type == "" {
+		resource.Type = "article"
+	}
+	return resource
 }
 
 // Function to scrape ML/AI articles and return the list
@@ -87,44 +87,32 @@ func scrapeArticles() ([]Article, error) {
 	return articles, nil
 }
 
-// Function to save articles to resources.json
+// Function to save articles to the resource catalog
 func saveArticles(articles []Article) error {
-	filePath := "resources.json"
-
-	// Read existing articles from JSON file
-	var resourceFile ResourceFileArticle
-	if _, err := os.Stat(filePath); err == nil {
-		// File exists, so load the existing data
-		file, err := ioutil.ReadFile(filePath)
-		if err != nil {
-			return err
-		}
-		if err := json.Unmarshal(file, &resourceFile); err != nil {
-			return err
-		}
+	resources, err := loadResources()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if _, err := takeBackup("scrape-articles"); err != nil {
+		return fmt.Errorf("error taking a backup: %v", err)
 	}
 
 	// Filter out duplicate articles
-	var newArticles []Article
+	added := 0
 	for _, article := range articles {
-		if !articleExists(resourceFile.Resources, article.Title) {
-			newArticles = append(newArticles, article)
+		if findResourceByTitle(resources.List, article.Title) < 0 {
+			resources.List = append(resources.List, article.toResource())
+			added++
 		}
 	}
 
-	// Add the new articles to the existing list
-	resourceFile.Resources = append(resourceFile.Resources, newArticles...)
-
-	// Write the updated list back to the file
-	data, err := json.MarshalIndent(resourceFile, "", "  ")
-	if err != nil {
-		return err
-	}
-	if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
+	// Write the updated list back to the store
+	if err := saveResources(resources); err != nil {
 		return err
 	}
 
-	fmt.Printf("Successfully saved %d new articles to resources.json\n", len(newArticles))
+	fmt.Printf("Successfully saved %d new articles to resources.json\n", added)
 	return nil
 }
 
@@ -1,3 +1,371 @@
 package main
 
 // THIS IS FOR SCRAPING PODCASTS:
+import (
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"golang.org/x/net/html/charset"
+)
+
+const itunesNamespace = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+
+func init() {
+	importers.register("podcast", "<feed-url|file> [--genre <genre>] [flags]",
+		"Import a podcast from its RSS feed: the show, and an entry per episode to mark as listened", importPodcast)
+}
+
+// xmlText is an element's text with its name, so <title> and <itunes:title> can be told
+// apart. encoding/xml matches a field without a namespace to both.
+type xmlText struct {
+	XMLName xml.Name
+	Text    string `xml:",chardata"`
+}
+
+// Function to get the text of the first non-empty element in a namespace, "" for plain RSS
+func textIn(elements []xmlText, space string) string {
+	for _, e := range elements {
+		if text := strings.TrimSpace(e.Text); text != "" && e.XMLName.Space == space {
+			return text
+		}
+	}
+	return ""
+}
+
+// Function to get the plain RSS element's text, or the iTunes one if there is none
+func podcastText(elements []xmlText) string {
+	if text := textIn(elements, ""); text != "" {
+		return text
+	}
+	return textIn(elements, itunesNamespace)
+}
+
+// itunesCategory is <itunes:category text="Technology">, which can hold subcategories.
+type itunesCategory struct {
+	Text          string           `xml:"text,attr"`
+	Subcategories []itunesCategory `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category"`
+}
+
+// The parts of a podcast feed we read: RSS 2.0 with the iTunes extensions.
+type podcastDocument struct {
+	XMLName xml.Name
+	Channel struct {
+		Title []xmlText `xml:"title"`
+		// Before Links, which would take <atom:link> too: an element goes to the first field it matches
+		SelfLink []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"http://www.w3.org/2005/Atom link"`
+		Links      []xmlText        `xml:"link"`
+		NewFeedURL string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd new-feed-url"`
+		Author     []xmlText        `xml:"author"`
+		Categories []itunesCategory `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category"`
+		Items      []podcastItem    `xml:"item"`
+	} `xml:"channel"`
+}
+
+type podcastItem struct {
+	Title       []xmlText `xml:"title"`
+	Links       []xmlText `xml:"link"`
+	GUID        string    `xml:"guid"`
+	PubDate     string    `xml:"pubDate"`
+	Author      []xmlText `xml:"author"`
+	Duration    string    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	EpisodeType string    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episodeType"`
+	Enclosure   struct {
+		URL string `xml:"url,attr"`
+	} `xml:"enclosure"`
+}
+
+// podcast is a show and its episodes, read from its feed.
+type podcast struct {
+	show     Resource
+	episodes []Resource // oldest first
+	skipped  int        // episodes with neither a link nor an audio file
+}
+
+// Function to read an itunes:duration, which is seconds ("3723") or H:MM:SS ("1:02:03", "62:03"),
+// 0 if it's neither
+func parseDuration(value string) int {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0
+	}
+	seconds := 0.0
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 || math.IsNaN(n) || math.IsInf(n, 0) {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return int(seconds)
+}
+
+// Function to turn the iTunes categories into tags, subcategories too
+func podcastTags(categories []itunesCategory) []string {
+	tags := []string{}
+	var add func(categories []itunesCategory)
+	add = func(categories []itunesCategory) {
+		for _, c := range categories {
+			if tag := strings.ToLower(strings.TrimSpace(c.Text)); tag != "" && !containsFold(tags, tag) {
+				tags = append(tags, tag)
+			}
+			add(c.Subcategories)
+		}
+	}
+	add(categories)
+	return tags
+}
+
+// Function to read a podcast's RSS feed. The show's link is the feed's own idea of its URL,
+// so importing it from the web or from a file finds the same show; feedURL, where it came
+// from, is the fallback.
+func readPodcast(r io.Reader, feedURL string) (podcast, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+	var doc podcastDocument
+	if err := decoder.Decode(&doc); err != nil {
+		return podcast{}, fmt.Errorf("reading the feed: %v", err)
+	}
+	if strings.ToLower(doc.XMLName.Local) != "rss" {
+		return podcast{}, fmt.Errorf("<%s> isn't an RSS feed, which is what podcasts are published as", doc.XMLName.Local)
+	}
+	channel := doc.Channel
+	website := textIn(channel.Links, "")
+
+	show := Resource{
+		Title:  podcastText(channel.Title),
+		Author: podcastText(channel.Author),
+		Type:   "podcast",
+		Link:   strings.TrimSpace(channel.NewFeedURL),
+		Tags:   podcastTags(channel.Categories),
+	}
+	for _, l := range channel.SelfLink {
+		if show.Link == "" && l.Rel == "self" {
+			show.Link = strings.TrimSpace(l.Href)
+		}
+	}
+	if show.Link == "" {
+		show.Link = feedURL
+	}
+	if show.Link == "" {
+		show.Link = website
+	}
+	if show.Title == "" {
+		return podcast{}, errors.New("the feed has no title")
+	}
+
+	// Some feeds give every episode the show's website as its link, the audio file
+	// tells those apart
+	links := make(map[string]int)
+	for _, item := range channel.Items {
+		links[textIn(item.Links, "")]++
+	}
+
+	p := podcast{show: show}
+	for _, item := range channel.Items {
+		episode := Resource{
+			Title:     podcastText(item.Title),
+			Author:    feedAuthor(podcastText(item.Author)),
+			Type:      "episode",
+			Tags:      []string{},
+			Duration:  parseDuration(item.Duration),
+			Enclosure: strings.TrimSpace(item.Enclosure.URL),
+		}
+		link := textIn(item.Links, "")
+		episode.Link = link
+		if link == "" || link == website || links[link] > 1 {
+			episode.Link = episode.Enclosure
+		}
+		if episode.Link == "" {
+			episode.Link = link
+		}
+		if episode.Link == "" {
+			color.Yellow("Skipping episode %q: it has no link or audio file.", episode.Title)
+			p.skipped++
+			continue
+		}
+		if episode.Title == "" {
+			episode.Title = episode.Link
+		}
+		if episode.Author == "" {
+			episode.Author = show.Author
+		}
+		if published := parseFeedDate(item.PubDate); !published.IsZero() {
+			episode.Published = published.UTC().Format(time.RFC3339)
+		}
+		if kind := strings.ToLower(strings.TrimSpace(item.EpisodeType)); kind == "trailer" || kind == "bonus" {
+			episode.Tags = append(episode.Tags, kind)
+		}
+		p.episodes = append(p.episodes, episode)
+	}
+	audio := false
+	for _, episode := range p.episodes {
+		audio = audio || episode.Enclosure != ""
+	}
+	if !audio && len(p.episodes) > 0 {
+		return podcast{}, errors.New("none of its entries has an audio file, for a blog or newsletter use `subscribe`")
+	}
+	// Oldest first, so the episode IDs follow the order they came out in. Feeds list the
+	// newest first, so if an episode has no date the feed's order is turned around instead.
+	dated := true
+	for _, episode := range p.episodes {
+		dated = dated && episode.Published != ""
+	}
+	if dated {
+		sort.SliceStable(p.episodes, func(i, j int) bool {
+			return p.episodes[i].Published < p.episodes[j].Published
+		})
+	} else {
+		for i, j := 0, len(p.episodes)-1; i < j; i, j = i+1, j-1 {
+			p.episodes[i], p.episodes[j] = p.episodes[j], p.episodes[i]
+		}
+	}
+	return p, nil
+}
+
+// Function to open a podcast feed, from the web or a file
+func openPodcastFeed(where string) (io.ReadCloser, string, error) {
+	if u, err := url.Parse(where); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		resp, err := httpClient.Get(where)
+		if err != nil {
+			return nil, "", err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, "", fmt.Errorf("%s answered %s", where, resp.Status)
+		}
+		return resp.Body, where, nil
+	}
+	f, err := os.Open(where)
+	return f, "", err
+}
+
+func importPodcast(fs *flag.FlagSet, args []string) error {
+	opts := addImportFlags(fs)
+	genre := fs.String("genre", "podcasts", "genre of the show and its episodes")
+	rest, err := parseExactArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	body, feedURL, err := openPodcastFeed(rest[0])
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	p, err := readPodcast(body, feedURL)
+	if err != nil {
+		return fmt.Errorf("%s: %w", rest[0], err)
+	}
+
+	// The episodes point at the show, so it needs its ID before the import hands out the rest
+	resources, err := loadResources()
+	if err != nil {
+		return fmt.Errorf("loading resources: %w", err)
+	}
+	p.show.Genre = *genre
+	if i := newCatalogMatcher(resources.List).findLink(p.show); i >= 0 {
+		p.show.ID = resources.List[i].ID
+	} else {
+		p.show.ID = newIDAllocator(resources.List).next(*genre)
+	}
+	batch := importBatch{
+		command:     "import-podcast",
+		source:      p.show.Title,
+		resources:   []Resource{p.show},
+		skippedRows: p.skipped,
+		linksOnly:   true,
+	}
+	if feedURL == "" {
+		batch.source = filepath.Base(rest[0])
+	}
+	for _, episode := range p.episodes {
+		episode.Genre = *genre
+		episode.Show = p.show.ID
+		batch.resources = append(batch.resources, episode)
+	}
+	color.Cyan("%s: %d episode(s) in the feed.", p.show.Title, len(p.episodes))
+	return commitImport(stdin, batch, opts)
+}
+
+// Function to run `episodes <show-id>`: a show's episodes, newest first, and how many are listened to
+func cliEpisodes(fs *flag.FlagSet, args []string) error {
+	unlistened := fs.Bool("unlistened", false, "only the episodes not listened to yet")
+	asJSON := fs.Bool("json", false, "print the episodes as JSON")
+	rest, err := parseExactArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	resources, err := loadResources()
+	if err != nil {
+		return err
+	}
+	var show *Resource
+	for i := range resources.List {
+		if strings.EqualFold(resources.List[i].ID, rest[0]) {
+			show = &resources.List[i]
+		}
+	}
+	if show == nil {
+		return withSuggestions(fmt.Errorf("%w: %s", errResourceNotFound, rest[0]), rest[0])
+	}
+
+	var episodes []Resource
+	listened := 0
+	total := 0
+	for _, r := range resources.List {
+		if !strings.EqualFold(r.Show, show.ID) {
+			continue
+		}
+		total++
+		if r.Status == "viewed" {
+			listened++
+			if *unlistened {
+				continue
+			}
+		}
+		episodes = append(episodes, r)
+	}
+	sort.SliceStable(episodes, func(i, j int) bool { return episodes[i].Published > episodes[j].Published })
+	if *asJSON {
+		return printJSON(episodes)
+	}
+	if total == 0 {
+		color.Yellow("%s has no episodes, import its feed with `import podcast`.", show.Title)
+		return nil
+	}
+
+	color.New(color.Bold).Printf("%s (%s)\n", show.Title, show.ID)
+	if len(episodes) > 0 {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"ID", "Published", "Duration", "Status", "Title"})
+		table.SetAutoWrapText(false)
+		for _, e := range episodes {
+			table.Append([]string{e.ID, addedDate(e.Published), durationText(e.Duration),
+				color.New(statusColors[e.Status]).Sprint(e.Status), shorten(e.Title, 60)})
+		}
+		table.Render()
+	}
+	fmt.Printf("%d of %d episode(s) listened to.\n", listened, total)
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"3723", 3723},
+		{" 3723 ", 3723},
+		{"3723.9", 3723},
+		{"1:02:03", 3723},
+		{"01:02:03", 3723},
+		{"62:03", 3723},
+		{"0:45", 45},
+		{"1:30:00.5", 5400},
+		{"", 0},
+		{"1:2:3:4", 0},
+		{"1::03", 0},
+		{"-5", 0},
+		{"1:-02", 0},
+		{"NaN", 0},
+		{"Inf", 0},
+		{"an hour", 0},
+	}
+	for _, tt := range tests {
+		if got := parseDuration(tt.value); got != tt.want {
+			t.Errorf("parseDuration(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+// Function to write a podcast feed with the given episodes as listed, each "title|pubDate"
+func podcastFeed(episodes ...string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"><channel><title>Test Show</title>`)
+	for i, episode := range episodes {
+		title, date, _ := strings.Cut(episode, "|")
+		fmt.Fprintf(&b, `<item><title>%s</title><enclosure url="https://cdn.example.com/%d.mp3" type="audio/mpeg"/>`, title, i)
+		if date != "" {
+			fmt.Fprintf(&b, "<pubDate>%s</pubDate>", date)
+		}
+		b.WriteString("</item>")
+	}
+	b.WriteString("</channel></rss>")
+	return b.String()
+}
+
+func TestReadPodcastEpisodeOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		episodes []string
+		want     string
+	}{
+		{"newest first", []string{"3|Wed, 03 Jan 2024 10:00:00 GMT", "2|Tue, 02 Jan 2024 10:00:00 GMT", "1|Mon, 01 Jan 2024 10:00:00 GMT"}, "123"},
+		{"out of order", []string{"2|Tue, 02 Jan 2024 10:00:00 GMT", "3|Wed, 03 Jan 2024 10:00:00 GMT", "1|Mon, 01 Jan 2024 10:00:00 GMT"}, "123"},
+		{"same date keeps feed order", []string{"a|Mon, 01 Jan 2024 10:00:00 GMT", "b|Mon, 01 Jan 2024 10:00:00 GMT"}, "ab"},
+		{"none dated", []string{"3", "2", "1"}, "123"},
+		{"one undated", []string{"3|Wed, 03 Jan 2024 10:00:00 GMT", "2", "1|Mon, 01 Jan 2024 10:00:00 GMT"}, "123"},
+	}
+	for _, tt := range tests {
+		p, err := readPodcast(strings.NewReader(podcastFeed(tt.episodes...)), "https://example.com/feed.xml")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got strings.Builder
+		for _, episode := range p.episodes {
+			got.WriteString(episode.Title)
+		}
+		if got.String() != tt.want {
+			t.Errorf("%s: episodes in the order %s, want %s", tt.name, got.String(), tt.want)
+		}
+	}
+}
@@ -2,9 +2,7 @@ package main
 
 // THIS IS FOR SCRAPING 400 BOOKS.
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"os"
 	"strings"
@@ -111,45 +109,42 @@ func scrapeBooks(urls []string) ([]Book, error) {
 	return allBooks, nil
 }
 
-// Define a struct to match the resources.json format
-type ResourceFile struct {
-	Resources []Book `json:"resources"`
+// Function to convert a scraped book into a catalog entry
+func (b Book) toResource() Resource {
+	return Resource{
+		Title:  b.Title,
+		Type:   "book",
+		Genre:  b.Category,
+		Status: "unread",
+		Link:   b.Link,
+		Tags:   b.Tags,
+		Author: b.Author,
+	}
 }
 
-// Function to save books to resources.json
+// Function to save books to the resource catalog
 func saveBooks(books []Book) error {
-	filePath := "resources.json"
+	resources, err := loadResources()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
 
-	// Read existing books from JSON file
-	var resourceFile ResourceFile
-	if _, err := os.Stat(filePath); err == nil {
-		// File exists, so load the existing data
-		file, err := ioutil.ReadFile(filePath)
-		if err != nil {
-			return err
-		}
-		if err := json.Unmarshal(file, &resourceFile); err != nil {
-			return err
-		}
+	if _, err := takeBackup("scrape-books"); err != nil {
+		return fmt.Errorf("error taking a backup: %v", err)
 	}
 
 	// Filter out duplicate books and update tags
 	for _, book := range books {
-		if existingBook, exists := bookExists(resourceFile.Resources, book.Title); exists {
+		if i := findResourceByTitle(resources.List, book.Title); i >= 0 {
 			// Update tags if the book already exists
-			existingBook.Tags = append(existingBook.Tags, book.Tags...)
+			resources.List[i].Tags = append(resources.List[i].Tags, book.Tags...)
 		} else {
 			// Add the new book
-			resourceFile.Resources = append(resourceFile.Resources, book)
+			resources.List = append(resources.List, book.toResource())
 		}
 	}
 
-	// Write the updated list back to the file
-	data, err := json.MarshalIndent(resourceFile, "", "  ")
-	if err != nil {
-		return err
-	}
-	if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
+	if err := saveResources(resources); err != nil {
 		return err
 	}
 
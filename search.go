@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/color"
+)
+
+// How much a match in each field counts towards a resource's score.
+var searchFieldWeights = map[string]float64{
+	"title":  3,
+	"author": 2,
+	"tags":   1.5,
+	"genre":  1,
+}
+
+// Words too common to be worth indexing.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "for": true, "from": true, "in": true, "into": true, "is": true, "it": true,
+	"of": true, "on": true, "or": true, "the": true, "to": true, "with": true,
+}
+
+var highlight = color.New(color.FgHiYellow, color.Bold, color.Underline)
+
+// searchIndex is an inverted index from stemmed terms to the resources that contain them.
+type searchIndex struct {
+	postings map[string]map[int]float64 // term -> position in the catalog -> weighted term frequency
+	docs     int
+}
+
+// Function to split text into lowercase words
+func splitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Function to turn text into index terms: words without stop words, stemmed
+func tokenize(text string) []string {
+	var terms []string
+	for _, w := range splitWords(text) {
+		if len([]rune(w)) < 2 || stopWords[w] {
+			continue
+		}
+		terms = append(terms, stem(w))
+	}
+	return terms
+}
+
+// Function to strip common English suffixes so "programming", "programs" and "program" match
+func stem(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+	switch {
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		word = word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "sses"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+	case strings.HasSuffix(word, "s"):
+		word = word[:len(word)-1]
+	}
+
+	stripped := false
+	for _, suffix := range []string{"ing", "ed"} {
+		if strings.HasSuffix(word, suffix) && len(word)-len(suffix) >= 3 {
+			word = word[:len(word)-len(suffix)]
+			stripped = true
+			break
+		}
+	}
+	// "running" -> "runn" -> "run"
+	if n := len(word); stripped && n >= 4 && word[n-1] == word[n-2] && !strings.ContainsRune("aeioulsz", rune(word[n-1])) {
+		word = word[:n-1]
+	}
+	return word
+}
+
+// Function to build the index over every resource's title, author, tags and genre
+func buildSearchIndex(resources []Resource) *searchIndex {
+	idx := &searchIndex{postings: make(map[string]map[int]float64), docs: len(resources)}
+	for i, r := range resources {
+		fields := map[string]string{
+			"title":  r.Title,
+			"author": r.Author,
+			"tags":   strings.Join(r.Tags, " "),
+			"genre":  r.Genre,
+		}
+		for field, text := range fields {
+			for _, term := range tokenize(text) {
+				if idx.postings[term] == nil {
+					idx.postings[term] = make(map[int]float64)
+				}
+				idx.postings[term][i] += searchFieldWeights[field]
+			}
+		}
+	}
+	return idx
+}
+
+// Function to rank resources for a query with TF-IDF. Resources matching more of the
+// query's terms always rank above ones matching fewer.
+func (idx *searchIndex) search(query string) []int {
+	terms := uniqueTerms(tokenize(query))
+	scores := make(map[int]float64)
+	matched := make(map[int]int)
+	for _, term := range terms {
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		idf := math.Log(1 + float64(idx.docs)/float64(len(postings)))
+		for i, tf := range postings {
+			scores[i] += tf * idf
+			matched[i]++
+		}
+	}
+
+	positions := make([]int, 0, len(scores))
+	for i := range scores {
+		positions = append(positions, i)
+	}
+	sort.Slice(positions, func(a, b int) bool {
+		pa, pb := positions[a], positions[b]
+		if matched[pa] != matched[pb] {
+			return matched[pa] > matched[pb]
+		}
+		if scores[pa] != scores[pb] {
+			return scores[pa] > scores[pb]
+		}
+		return pa < pb
+	})
+	return positions
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, t := range terms {
+		if !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+// Function to search the catalog, best match first. The index is built on first use and after every change.
+func (c *Catalog) Search(query string) ([]Resource, error) {
+	if err := c.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	if c.search == nil {
+		c.search = buildSearchIndex(c.resources.List)
+	}
+	var hits []Resource
+	for _, i := range c.search.search(query) {
+		hits = append(hits, c.resources.List[i])
+	}
+	return hits, nil
+}
+
+// Function to wrap the words of text that match one of the query terms in the highlight color
+func highlightMatches(text string, terms map[string]bool) (string, bool) {
+	var b strings.Builder
+	found := false
+	word := []rune{}
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := string(word)
+		if terms[stem(strings.ToLower(w))] {
+			b.WriteString(highlight.Sprint(w))
+			found = true
+		} else {
+			b.WriteString(w)
+		}
+		word = word[:0]
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteRune(r)
+	}
+	flush()
+	return b.String(), found
+}
+
+// Function to get the set of terms a query searches for
+func searchTerms(query string) map[string]bool {
+	terms := make(map[string]bool)
+	for _, t := range tokenize(query) {
+		terms[t] = true
+	}
+	return terms
+}
+
+// Function to get the table decorator that highlights the terms in the fields search looks at
+func highlightSearchFields(terms map[string]bool) func(field, value string) (string, bool) {
+	return func(field, value string) (string, bool) {
+		switch field {
+		case "Title", "Author", "Genre", "Tags":
+			return highlightMatches(value, terms)
+		}
+		return value, false
+	}
+}
+
+// Function to search the catalog and page through the ranked results
+func searchResources(reader *bufio.Reader, args []string) {
+	args, format, err := extractFormatFlag(args)
+	if err != nil {
+		color.Red("Error: %v", err)
+		return
+	}
+	query := strings.Join(args, " ")
+	if query == "" {
+		fmt.Print("Enter search terms: ")
+		query, _ = reader.ReadString('\n')
+		query = strings.TrimSpace(query)
+	}
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		color.Yellow("Nothing to search for, try more specific words.")
+		return
+	}
+
+	hits, err := catalog.Search(query)
+	if err != nil {
+		color.Red("Error loading resources: %v", err)
+		return
+	}
+	if format != formatTable {
+		if err := writeResources(os.Stdout, format, hits); err != nil {
+			reportError(err)
+		}
+		return
+	}
+	if len(hits) == 0 {
+		color.Yellow("No resources match '%s'.", query)
+		return
+	}
+
+	color.Cyan("%d resource(s) match '%s', best matches first:", len(hits), query)
+	showResourcePages(hits, highlightSearchFields(terms), nil)
+}
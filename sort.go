@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// sortKey orders resources by one field, compare returns <0, 0 or >0 like strings.Compare.
+type sortKey struct {
+	description string
+	compare     func(a, b Resource) int
+}
+
+// sortKeys holds every key `--sort` accepts. New fields register their key here.
+var sortKeys = map[string]sortKey{}
+
+// Function to make a key available to `--sort`
+func registerSortKey(name, description string, compare func(a, b Resource) int) {
+	sortKeys[name] = sortKey{description: description, compare: compare}
+}
+
+// collator compares text the way the user's locale sorts it.
+var collator = collate.New(userLanguage(), collate.IgnoreCase, collate.Numeric)
+
+// Function to read the user's language from the environment, English when it isn't set
+func userLanguage() language.Tag {
+	for _, name := range []string{"LC_ALL", "LC_COLLATE", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		// e.g. de_DE.UTF-8
+		value, _, _ = strings.Cut(value, ".")
+		if value == "C" || value == "POSIX" {
+			break
+		}
+		if tag, err := language.Parse(strings.ReplaceAll(value, "_", "-")); err == nil {
+			return tag
+		}
+	}
+	return language.English
+}
+
+// Leading articles that don't count when sorting titles.
+var leadingArticles = []string{"the ", "a ", "an "}
+
+// Function to drop a leading "The", "A" or "An" from a title
+func sortableTitle(title string) string {
+	title = strings.TrimSpace(title)
+	lower := strings.ToLower(title)
+	for _, article := range leadingArticles {
+		if strings.HasPrefix(lower, article) && len(title) > len(article) {
+			return strings.TrimSpace(title[len(article):])
+		}
+	}
+	return title
+}
+
+func compareText(a, b string) int {
+	return collator.CompareString(a, b)
+}
+
+func init() {
+	registerSortKey("id", "resource ID", func(a, b Resource) int { return compareText(a.ID, b.ID) })
+	registerSortKey("title", "title, ignoring a leading The/A/An", func(a, b Resource) int {
+		return compareText(sortableTitle(a.Title), sortableTitle(b.Title))
+	})
+	registerSortKey("author", "author", func(a, b Resource) int { return compareText(a.Author, b.Author) })
+	registerSortKey("genre", "genre", func(a, b Resource) int { return compareText(a.Genre, b.Genre) })
+	registerSortKey("type", "type", func(a, b Resource) int { return compareText(a.Type, b.Type) })
+	registerSortKey("status", "status", func(a, b Resource) int { return compareText(a.Status, b.Status) })
+	registerSortKey("link", "link", func(a, b Resource) int { return strings.Compare(a.Link, b.Link) })
+	registerSortKey("tags", "number of tags", func(a, b Resource) int { return len(a.Tags) - len(b.Tags) })
+	registerSortKey("rating", "rating, unrated first", func(a, b Resource) int { return a.Rating - b.Rating })
+	registerSortKey("added", "date added, unknown first", func(a, b Resource) int { return strings.Compare(a.AddedAt, b.AddedAt) })
+	registerSortKey("published", "date published, unknown first", func(a, b Resource) int { return strings.Compare(a.Published, b.Published) })
+	registerSortKey("duration", "length, unknown first", func(a, b Resource) int { return a.Duration - b.Duration })
+}
+
+// sortField is one key of a sort spec, e.g. -author.
+type sortField struct {
+	key  string
+	desc bool
+}
+
+// sortSpec is a parsed `--sort` value, keys are applied in order.
+type sortSpec []sortField
+
+func (s sortSpec) String() string {
+	var parts []string
+	for _, f := range s {
+		if f.desc {
+			parts = append(parts, "-"+f.key)
+		} else {
+			parts = append(parts, f.key)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Function to parse a sort spec like "title,-author", a leading minus sorts that key descending
+func parseSortSpec(spec string) (sortSpec, error) {
+	var fields sortSpec
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		f := sortField{key: part}
+		if strings.HasPrefix(part, "-") {
+			f = sortField{key: strings.TrimPrefix(part, "-"), desc: true}
+		} else if strings.HasPrefix(part, "+") {
+			f.key = strings.TrimPrefix(part, "+")
+		}
+		if _, ok := sortKeys[f.key]; !ok {
+			return nil, fmt.Errorf("can't sort by %q, use one of %s", f.key, strings.Join(sortKeyNames(), ", "))
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no sort keys given, use one of %s", strings.Join(sortKeyNames(), ", "))
+	}
+	return fields, nil
+}
+
+func sortKeyNames() []string {
+	var names []string
+	for name := range sortKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Function to return a sorted copy of resources, ties keep their original order
+func sortResources(resources []Resource, spec sortSpec) []Resource {
+	sorted := append([]Resource(nil), resources...)
+	if len(spec) == 0 {
+		return sorted
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		for _, f := range spec {
+			c := sortKeys[f.key].compare(sorted[i], sorted[j])
+			if f.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return sorted
+}
+
+// Function to take `--sort spec` (or `--sort=spec`) out of a command's arguments
+func extractSortFlag(args []string) ([]string, sortSpec, error) {
+	rest, value, found, err := extractValueFlag(args, "--sort", "--sort title,-author")
+	if err != nil || !found {
+		return rest, nil, err
+	}
+	spec, err := parseSortSpec(value)
+	return rest, spec, err
+}
+
+// Function to take `name value` (or `name=value`) out of a command's arguments, the last one wins.
+// example is shown when the value is missing.
+func extractValueFlag(args []string, name, example string) (rest []string, value string, found bool, err error) {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == name:
+			if i+1 == len(args) {
+				return nil, "", false, fmt.Errorf("%s needs a value, e.g. %s", name, example)
+			}
+			i++
+			value, found = args[i], true
+		case strings.HasPrefix(args[i], name+"="):
+			value, found = strings.TrimPrefix(args[i], name+"="), true
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return rest, value, found, nil
+}
@@ -0,0 +1,609 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+const sourcesFile = "sources.json"
+
+// Kinds of sources fetch-updates can read.
+const (
+	sourceSheet = "sheet" // a Google Sheet, read as CSV
+	sourceCSV   = "csv"   // any CSV file on the web
+	sourceFeed  = "feed"  // an RSS or Atom feed
+)
+
+var sourceKinds = []string{sourceSheet, sourceCSV, sourceFeed}
+
+var errSourceNotFound = errors.New("no such source")
+
+// source is one place fetch-updates reads resources from.
+type source struct {
+	Name     string      `json:"name"`
+	Kind     string      `json:"kind"`
+	URL      string      `json:"url,omitempty"`      // csv and feed
+	SheetID  string      `json:"sheet_id,omitempty"` // sheet
+	Range    string      `json:"range,omitempty"`    // sheet, all columns if not set
+	Mapping  *csvMapping `json:"mapping,omitempty"`  // csv and sheet, like `import csv`
+	Genre    string      `json:"genre,omitempty"`    // for resources without one
+	Tags     []string    `json:"tags,omitempty"`     // added to every resource
+	Disabled bool        `json:"disabled,omitempty"`
+	State    *feedState  `json:"state,omitempty"` // feed, kept up to date by fetch-updates
+}
+
+// sourcesConfig is sources.json in the data directory.
+type sourcesConfig struct {
+	Sources []source `json:"sources"`
+}
+
+// The sources used until sources.json exists: the shared sheet, whose columns are
+// title, author, link, genre, tags and type.
+func defaultSources() sourcesConfig {
+	return sourcesConfig{Sources: []source{{
+		Name:    "shared-sheet",
+		Kind:    sourceSheet,
+		SheetID: updatesSheetID,
+		Range:   "A:F",
+		Mapping: &csvMapping{Columns: map[string]string{
+			"#1": "title", "#2": "author", "#3": "link", "#4": "genre", "#5": "tags", "#6": "type",
+		}},
+	}}}
+}
+
+func sourcesStore() *jsonFile {
+	return &jsonFile{path: dataPath(sourcesFile)}
+}
+
+// Function to read sources.json, the default sources if it doesn't exist yet
+func loadSources() (sourcesConfig, error) {
+	var config sourcesConfig
+	err := sourcesStore().read(&config)
+	if os.IsNotExist(err) {
+		return defaultSources(), nil
+	}
+	return config, err
+}
+
+// Function to change sources.json under its lock, starting from the defaults if it doesn't exist yet
+func updateSources(fn func(config *sourcesConfig) error) error {
+	f := sourcesStore()
+	return withFileLock(f.path, func() error {
+		var config sourcesConfig
+		if err := f.read(&config); os.IsNotExist(err) {
+			config = defaultSources()
+		} else if err != nil {
+			return err
+		}
+		if err := fn(&config); err != nil {
+			return err
+		}
+		return f.write(&config)
+	})
+}
+
+func findSource(sources []source, name string) int {
+	for i, s := range sources {
+		if strings.EqualFold(s.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// The CSV export of a Google Sheet. Tests point it at a stand-in server.
+var sheetCSVURL = "https://docs.google.com/spreadsheets/d/%s/gviz/tq?tqx=out:csv"
+
+// httpClient fetches every source.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// Function to get the URL a source is fetched from
+func (s source) fetchURL() string {
+	if s.Kind != sourceSheet {
+		return s.URL
+	}
+	u := fmt.Sprintf(sheetCSVURL, url.PathEscape(s.SheetID))
+	if s.Range != "" {
+		u += "&range=" + url.QueryEscape(s.Range)
+	}
+	return u
+}
+
+// fetched is what fetching a source brought back.
+type fetched struct {
+	resources   []Resource
+	skipped     int        // rows that couldn't be used, already reported
+	title       string     // of a feed
+	state       *feedState // of a feed, to remember once the entries are synced
+	guids       []string   // of a feed, the item each resource came from
+	notModified bool       // the feed hasn't changed since the last fetch
+}
+
+// Function to fetch a source and turn what it has into resources, with its tags added.
+// Feeds are asked for changes since the last fetch and only bring their new entries.
+func fetchSource(client *http.Client, s source) (fetched, error) {
+	req, err := http.NewRequest(http.MethodGet, s.fetchURL(), nil)
+	if err != nil {
+		return fetched{}, err
+	}
+	if s.Kind == sourceFeed && s.State != nil {
+		if s.State.ETag != "" {
+			req.Header.Set("If-None-Match", s.State.ETag)
+		}
+		if s.State.LastModified != "" {
+			req.Header.Set("If-Modified-Since", s.State.LastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fetched{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && s.Kind == sourceFeed {
+		return fetched{notModified: true}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fetched{}, fmt.Errorf("%s answered %s", s.fetchURL(), resp.Status)
+	}
+
+	var result fetched
+	switch s.Kind {
+	case sourceSheet, sourceCSV:
+		var mapping csvMapping
+		if s.Mapping != nil {
+			mapping = *s.Mapping
+		}
+		result.resources, result.skipped, err = readCSVResources(resp.Body, mapping)
+	case sourceFeed:
+		var f feed
+		if f, err = parseFeed(resp.Body); err != nil {
+			break
+		}
+		result.title = f.Title
+		result.state = &feedState{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			CheckedAt:    time.Now().UTC().Format(time.RFC3339),
+		}
+		var lastSeen string
+		if s.State != nil {
+			lastSeen = s.State.LastGUID
+			result.state.LastGUID = lastSeen
+		}
+		if items := f.newestFirst(); len(items) > 0 {
+			result.state.LastGUID = items[0].GUID
+		}
+		result.resources, result.guids = feedResources(f.itemsSince(lastSeen))
+	default:
+		err = fmt.Errorf("unknown kind %q", s.Kind)
+	}
+	if err != nil {
+		return fetched{}, err
+	}
+	for i := range result.resources {
+		for _, tag := range s.Tags {
+			if !containsFold(result.resources[i].Tags, tag) {
+				result.resources[i].Tags = append(result.resources[i].Tags, tag)
+			}
+		}
+	}
+	return result, nil
+}
+
+// Function to remember where a feed source got to
+func saveFeedState(name string, state *feedState) error {
+	return updateSources(func(config *sourcesConfig) error {
+		if i := findSource(config.Sources, name); i >= 0 {
+			config.Sources[i].State = state
+		}
+		return nil
+	})
+}
+
+// Function to fetch a source and sync the catalog with it
+func syncSource(reader *bufio.Reader, client *http.Client, command string, s source, opts syncOptions) error {
+	result, err := fetchSource(client, s)
+	if err != nil {
+		return err
+	}
+	return syncFetched(reader, command, s, result, opts)
+}
+
+// Function to sync the catalog with what was fetched from a source. A feed's state is only
+// moved on once its entries are in the catalog, so a dry run or a rejected sync leaves them
+// to come again.
+func syncFetched(reader *bufio.Reader, command string, s source, result fetched, opts syncOptions) error {
+	if result.notModified {
+		color.Green("Not modified since the last fetch.")
+		return nil
+	}
+	if result.skipped > 0 {
+		color.Yellow("%d row(s) were skipped, see the warnings above.", result.skipped)
+	}
+	var settled []bool
+	if s.Kind == sourceFeed && len(result.resources) == 0 {
+		color.Green("No new entries.")
+		if opts.dryRun {
+			return nil
+		}
+	} else {
+		var err error
+		settled, err = syncResources(reader, command, importBatch{source: s.Name, resources: result.resources, genre: s.Genre}, opts)
+		if err != nil {
+			return err
+		}
+	}
+	if state := result.syncedState(settled); state != nil {
+		return saveFeedState(s.Name, state)
+	}
+	return nil
+}
+
+// Function to work out the state a feed gets to once the rows marked settled are in the
+// catalog, nil if it stays where it was. LastGUID only moves over the oldest entries that
+// all made it in, so an entry declined or never asked about while picking comes again; the
+// ETag and Last-Modified are dropped then, or the next fetch could be answered "not modified".
+func (result fetched) syncedState(settled []bool) *feedState {
+	if result.state == nil {
+		return nil
+	}
+	n := 0
+	for n < len(settled) && settled[n] {
+		n++
+	}
+	if n == len(result.guids) {
+		return result.state
+	}
+	if n == 0 {
+		return nil
+	}
+	state := *result.state
+	state.LastGUID, state.ETag, state.LastModified = result.guids[n-1], "", ""
+	return &state
+}
+
+// Function to fetch every enabled source, or only the named one, and sync the catalog
+// with each in turn. A source that fails is reported and the others still run.
+func fetchUpdates(reader *bufio.Reader, client *http.Client, only string, opts syncOptions) error {
+	config, err := loadSources()
+	if err != nil {
+		return err
+	}
+	var sources []source
+	for _, s := range config.Sources {
+		if only != "" && !strings.EqualFold(s.Name, only) {
+			continue
+		}
+		if !s.Disabled || only != "" {
+			sources = append(sources, s)
+		}
+	}
+	if only != "" && len(sources) == 0 {
+		return fmt.Errorf("%w: %s, see `sources list`", errSourceNotFound, only)
+	}
+	if len(sources) == 0 {
+		color.Yellow("No sources are enabled, add one with `sources add`.")
+		return nil
+	}
+
+	failed := 0
+	for _, s := range sources {
+		color.New(color.Bold).Printf("%s (%s)\n", s.Name, s.Kind)
+		if err := syncSource(reader, client, "fetch-updates", s, opts); err != nil {
+			reportError(fmt.Errorf("%s: %w", s.Name, err))
+			failed++
+		}
+	}
+	if len(sources) > 1 {
+		fmt.Printf("%d source(s) fetched, %d failed.\n", len(sources)-failed, failed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d source(s) failed", failed, len(sources))
+	}
+	return nil
+}
+
+// sourceCommands are the subcommands of `sources`.
+var sourceCommands = map[string]cliCommand{
+	"list":    {"[--json]", "List the sources fetch-updates reads", cliSourcesList},
+	"add":     {"<name> <url|sheet id> [flags]", "Add a sheet, CSV file or feed", cliSourcesAdd},
+	"remove":  {"<name>", "Remove a source", cliSourcesRemove},
+	"enable":  {"<name>", "Fetch a source again", cliSourcesEnable(true)},
+	"disable": {"<name>", "Skip a source without removing it", cliSourcesEnable(false)},
+}
+
+// Function to run `sources <list|add|remove|enable|disable>`, a plain `sources` lists them
+func cliSources(fs *flag.FlagSet, args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		if len(args) == 0 {
+			return cliSourcesList(fs, args)
+		}
+		fmt.Println("Usage: outgo sources <command> [args] [flags]")
+		for _, name := range []string{"list", "add", "remove", "enable", "disable"} {
+			fmt.Printf("  %-8s %-32s %s\n", name, sourceCommands[name].args, sourceCommands[name].summary)
+		}
+		return flag.ErrHelp
+	}
+	cmd, ok := sourceCommands[strings.ToLower(args[0])]
+	if !ok {
+		return usageErrorf("unknown sources command %q, use list, add, remove, enable or disable", args[0])
+	}
+	name := "sources " + strings.ToLower(args[0])
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: outgo %s %s\n%s\n", name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	return cmd.run(fs, args[1:])
+}
+
+func cliSourcesList(fs *flag.FlagSet, args []string) error {
+	asJSON := fs.Bool("json", false, "print the sources as JSON")
+	if _, err := parseExactArgs(fs, args, 0); err != nil {
+		return err
+	}
+	config, err := loadSources()
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(config.Sources)
+	}
+	if len(config.Sources) == 0 {
+		color.Yellow("No sources, add one with `sources add`.")
+		return nil
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Kind", "Where", "Genre", "Tags", "Enabled"})
+	table.SetAutoWrapText(false)
+	for _, s := range config.Sources {
+		where := s.URL
+		if s.Kind == sourceSheet {
+			where = s.SheetID
+			if s.Range != "" {
+				where += " " + s.Range
+			}
+		}
+		enabled := "yes"
+		if s.Disabled {
+			enabled = "no"
+		}
+		table.Append([]string{s.Name, s.Kind, shorten(where, 60), s.Genre, strings.Join(s.Tags, ", "), enabled})
+	}
+	table.Render()
+	return nil
+}
+
+// Google Sheets links look like https://docs.google.com/spreadsheets/d/<id>/edit#gid=0
+var sheetLinkPattern = regexp.MustCompile(`docs\.google\.com/spreadsheets/d/([A-Za-z0-9_-]+)`)
+
+// Function to guess a source's kind from where it is: sheet links, then feeds by their
+// usual names, anything else is read as CSV
+func guessSourceKind(where string) string {
+	lower := strings.ToLower(where)
+	switch {
+	case sheetLinkPattern.MatchString(where) || !strings.Contains(where, "/"):
+		return sourceSheet
+	case strings.Contains(lower, "rss") || strings.Contains(lower, "atom") || strings.Contains(lower, "feed") ||
+		strings.HasSuffix(lower, ".xml"):
+		return sourceFeed
+	}
+	return sourceCSV
+}
+
+func cliSourcesAdd(fs *flag.FlagSet, args []string) error {
+	kind := fs.String("kind", "", "sheet, csv or feed (guessed from the URL if not given)")
+	sheetRange := fs.String("range", "", "columns of a sheet to read, e.g. A:F")
+	mapFlag := fs.String("map", "", "column mapping for sheets and CSV files, e.g. 'Book Title=title,#2=author'")
+	delimiter := fs.String("delimiter", "", "field delimiter of a CSV file")
+	genre := fs.String("genre", "", "genre for resources that don't have one")
+	tags := fs.String("tags", "", "comma-separated tags added to every resource")
+	disabled := fs.Bool("disabled", false, "add the source without fetching it yet")
+	rest, err := parseExactArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+
+	s := source{Name: rest[0], Kind: strings.ToLower(*kind), Range: *sheetRange, Genre: *genre, Disabled: *disabled}
+	where := rest[1]
+	if s.Kind == "" {
+		s.Kind = guessSourceKind(where)
+	}
+	switch s.Kind {
+	case sourceSheet:
+		s.SheetID = where
+		if m := sheetLinkPattern.FindStringSubmatch(where); m != nil {
+			s.SheetID = m[1]
+		}
+	case sourceCSV, sourceFeed:
+		if u, err := url.Parse(where); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return usageErrorf("%q isn't an http or https URL", where)
+		}
+		s.URL = where
+	default:
+		return usageErrorf("unknown kind %q, use one of %s", s.Kind, strings.Join(sourceKinds, ", "))
+	}
+	if s.Kind == sourceFeed && (*mapFlag != "" || *delimiter != "" || *sheetRange != "") {
+		return usageErrorf("--map, --delimiter and --range are for sheets and CSV files")
+	}
+	columns, err := parsePairs(*mapFlag, "mapping")
+	if err != nil {
+		return err
+	}
+	for header, field := range columns {
+		if !isCSVField(strings.ToLower(field)) {
+			return usageErrorf("can't map %q to %q, use one of %s", header, field, strings.Join(csvFields, ", "))
+		}
+	}
+	if _, err := parseDelimiter(*delimiter); err != nil {
+		return err
+	}
+	if len(columns) > 0 || *delimiter != "" {
+		s.Mapping = &csvMapping{Delimiter: *delimiter}
+		if len(columns) > 0 {
+			s.Mapping.Columns = columns
+		}
+	}
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			s.Tags = append(s.Tags, tag)
+		}
+	}
+
+	err = updateSources(func(config *sourcesConfig) error {
+		if findSource(config.Sources, s.Name) >= 0 {
+			return usageErrorf("there is already a source named %q", s.Name)
+		}
+		config.Sources = append(config.Sources, s)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	color.Green("Added %s source %q.", s.Kind, s.Name)
+	return nil
+}
+
+func cliSourcesRemove(fs *flag.FlagSet, args []string) error {
+	rest, err := parseExactArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	err = updateSources(func(config *sourcesConfig) error {
+		i := findSource(config.Sources, rest[0])
+		if i < 0 {
+			return fmt.Errorf("%w: %s", errSourceNotFound, rest[0])
+		}
+		config.Sources = append(config.Sources[:i], config.Sources[i+1:]...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	color.Green("Removed source %q.", rest[0])
+	return nil
+}
+
+func cliSourcesEnable(enable bool) func(fs *flag.FlagSet, args []string) error {
+	return func(fs *flag.FlagSet, args []string) error {
+		rest, err := parseExactArgs(fs, args, 1)
+		if err != nil {
+			return err
+		}
+		err = updateSources(func(config *sourcesConfig) error {
+			i := findSource(config.Sources, rest[0])
+			if i < 0 {
+				return fmt.Errorf("%w: %s", errSourceNotFound, rest[0])
+			}
+			config.Sources[i].Disabled = !enable
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if enable {
+			color.Green("Source %q is enabled.", rest[0])
+		} else {
+			color.Green("Source %q is disabled.", rest[0])
+		}
+		return nil
+	}
+}
+
+// Function to name a feed after its title, or its site if it has none, e.g. "the-morning-paper"
+func feedSourceName(title, feedURL string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+		if b.Len() >= 40 {
+			break
+		}
+	}
+	if b.Len() > 0 {
+		return b.String()
+	}
+	if u, err := url.Parse(feedURL); err == nil && u.Host != "" {
+		return strings.TrimPrefix(u.Hostname(), "www.")
+	}
+	return "feed"
+}
+
+// Function to run `subscribe <feed-url>`: add the feed as a source and bring in its entries
+func cliSubscribe(fs *flag.FlagSet, args []string) error {
+	var opts syncOptions
+	name := fs.String("name", "", "name of the source (the feed's title if not given)")
+	genre := fs.String("genre", "", "genre for the feed's articles")
+	tags := fs.String("tags", "", "comma-separated tags added to every article")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "only show what would be added, don't subscribe")
+	fs.BoolVar(&opts.yes, "yes", false, "add the entries without asking")
+	rest, err := parseExactArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	feedURL := rest[0]
+	if u, err := url.Parse(feedURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return usageErrorf("%q isn't an http or https URL", feedURL)
+	}
+	config, err := loadSources()
+	if err != nil {
+		return err
+	}
+	for _, s := range config.Sources {
+		if s.Kind == sourceFeed && s.URL == feedURL {
+			return usageErrorf("already subscribed to %s as %q, fetch it with `fetch-updates --source %s`", feedURL, s.Name, s.Name)
+		}
+	}
+
+	s := source{Name: *name, Kind: sourceFeed, URL: feedURL, Genre: *genre}
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			s.Tags = append(s.Tags, tag)
+		}
+	}
+	result, err := fetchSource(httpClient, s)
+	if err != nil {
+		return err
+	}
+	if s.Name == "" {
+		s.Name = feedSourceName(result.title, feedURL)
+	}
+	if findSource(config.Sources, s.Name) >= 0 {
+		return usageErrorf("there is already a source named %q, pick another with --name", s.Name)
+	}
+	color.New(color.Bold).Printf("%s (%d entries)\n", s.Name, len(result.resources))
+
+	if !opts.dryRun {
+		err = updateSources(func(config *sourcesConfig) error {
+			if findSource(config.Sources, s.Name) >= 0 {
+				return usageErrorf("there is already a source named %q, pick another with --name", s.Name)
+			}
+			config.Sources = append(config.Sources, s)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		color.Green("Subscribed to %s, `fetch-updates` brings in its new entries from now on.", feedURL)
+	}
+	return syncFetched(stdin, "subscribe", s, result, opts)
+}
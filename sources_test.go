@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Function to run the commands of a test against a fresh data directory, seeded like a first run
+func useTempDataDir(t *testing.T) {
+	t.Helper()
+	previousDir, previousBackend := *dataDirFlag, *storeBackend
+	*dataDirFlag = t.TempDir()
+	*storeBackend = storeJSON
+	store, catalog = nil, &Catalog{}
+	t.Cleanup(func() {
+		if store != nil {
+			store.Close()
+		}
+		store, catalog = nil, &Catalog{}
+		*dataDirFlag, *storeBackend = previousDir, previousBackend
+	})
+}
+
+// Function to run `outgo <command> [args]`, failing the test on an error
+func mustRun(t *testing.T, command string, args ...string) {
+	t.Helper()
+	if err := runCommand(command, args); err != nil {
+		t.Fatalf("%s %s: %v", command, strings.Join(args, " "), err)
+	}
+}
+
+// Function to find a catalog resource by title, failing the test if there is none
+func resourceTitled(t *testing.T, title string) Resource {
+	t.Helper()
+	catalog.Invalidate()
+	resources, err := catalog.Resources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := findResourceByTitle(resources, title); i >= 0 {
+		return resources[i]
+	}
+	t.Fatalf("no resource titled %q", title)
+	return Resource{}
+}
+
+func TestFetchUpdatesSheet(t *testing.T) {
+	useTempDataDir(t)
+	var asked string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asked = r.URL.Path + "?" + r.URL.Query().Get("range")
+		fmt.Fprint(w, "Title,Author,Link,Genre,Tags,Type\n"+
+			"Bad Blood,John Carreyrou,,tech,\"startups, fraud\",book\n"+
+			"The Soul of a New Machine,Tracy Kidder,https://example.com/soul,tech,computers,book\n")
+	}))
+	defer server.Close()
+	previous := sheetCSVURL
+	sheetCSVURL = server.URL + "/spreadsheets/d/%s/gviz/tq?tqx=out:csv"
+	defer func() { sheetCSVURL = previous }()
+
+	// No sources.json yet, so this is the shared sheet
+	mustRun(t, "fetch-updates", "--yes")
+
+	if want := "/spreadsheets/d/" + updatesSheetID + "/gviz/tq?A:F"; asked != want {
+		t.Errorf("fetched %s, want %s", asked, want)
+	}
+	added := resourceTitled(t, "The Soul of a New Machine")
+	if !strings.HasPrefix(added.ID, "tech") || added.Author != "Tracy Kidder" || added.Link != "https://example.com/soul" {
+		t.Errorf("added %+v", added)
+	}
+	updated := resourceTitled(t, "Bad Blood")
+	if updated.ID != "tech001" || !containsFold(updated.Tags, "fraud") || !containsFold(updated.Tags, "startups") {
+		t.Errorf("Bad Blood is %+v, want tech001 with the sheet's tags", updated)
+	}
+}
+
+func TestFetchUpdatesCSV(t *testing.T) {
+	useTempDataDir(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/reading.csv" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "Book;Written by;URL\n"+
+			"A Field Guide to Test Servers;Ada Example;https://example.com/guide\n"+
+			";nobody;https://example.com/untitled\n")
+	}))
+	defer server.Close()
+
+	mustRun(t, "sources", "add", "reading", server.URL+"/reading.csv", "--delimiter", ";",
+		"--map", "Book=title,Written by=author,URL=link", "--genre", "philosophy", "--tags", "club")
+	mustRun(t, "fetch-updates", "--source", "reading", "--yes")
+
+	r := resourceTitled(t, "A Field Guide to Test Servers")
+	if r.Genre != "philosophy" || r.Author != "Ada Example" || !containsFold(r.Tags, "club") {
+		t.Errorf("imported %+v", r)
+	}
+
+	// A source that answers with an error makes fetch-updates fail
+	mustRun(t, "sources", "add", "gone", server.URL+"/gone.csv")
+	if err := runCommand("fetch-updates", []string{"--source", "gone", "--yes"}); err == nil {
+		t.Error("fetching a missing CSV file succeeded")
+	}
+}
+
+// Function to write an RSS feed with the given items, newest first, each "guid|title|date"
+func rssFeed(items ...string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><rss version="2.0"><channel><title>Test Blog</title>`)
+	for _, item := range items {
+		parts := strings.Split(item, "|")
+		fmt.Fprintf(&b, "<item><guid>%s</guid><title>%s</title><link>https://blog.example.com/%s</link><pubDate>%s</pubDate></item>",
+			parts[0], parts[1], parts[0], parts[2])
+	}
+	b.WriteString("</channel></rss>")
+	return b.String()
+}
+
+func TestFetchUpdatesFeed(t *testing.T) {
+	useTempDataDir(t)
+	body := rssFeed("b|Second Post|Tue, 02 Jan 2024 10:00:00 GMT", "a|First Post|Mon, 01 Jan 2024 10:00:00 GMT")
+	etag := `"v1"`
+	fetches, notModified := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	mustRun(t, "subscribe", server.URL+"/feed.xml", "--genre", "blogs", "--yes")
+	first := resourceTitled(t, "First Post")
+	second := resourceTitled(t, "Second Post")
+	if first.Genre != "blogs" || first.Link != "https://blog.example.com/a" || first.ID >= second.ID {
+		t.Errorf("subscribed to %+v and %+v, want blogs entries oldest first", first, second)
+	}
+
+	config, err := loadSources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := findSource(config.Sources, "test-blog")
+	if i < 0 || config.Sources[i].State == nil || config.Sources[i].State.LastGUID != "b" || config.Sources[i].State.ETag != etag {
+		t.Fatalf("sources are %+v, want test-blog at b with ETag %s", config.Sources, etag)
+	}
+
+	// Unchanged: the server is asked with the ETag and nothing is imported
+	mustRun(t, "fetch-updates", "--source", "test-blog", "--yes")
+	if notModified != 1 {
+		t.Errorf("%d conditional fetch(es) answered 304, want 1", notModified)
+	}
+
+	// A new post: only it is imported
+	body = rssFeed("c|Third Post|Wed, 03 Jan 2024 10:00:00 GMT", "b|Second Post|Tue, 02 Jan 2024 10:00:00 GMT",
+		"a|First Post|Mon, 01 Jan 2024 10:00:00 GMT")
+	etag = `"v2"`
+	before, _ := catalog.Resources()
+	mustRun(t, "fetch-updates", "--source", "test-blog", "--yes")
+	resourceTitled(t, "Third Post")
+	after, _ := catalog.Resources()
+	if len(after) != len(before)+1 {
+		t.Errorf("the catalog went from %d to %d resources, want one more", len(before), len(after))
+	}
+	if fetches != 3 {
+		t.Errorf("the feed was fetched %d times, want 3", fetches)
+	}
+}
+
+// Function to get the GUID a feed source got to, "" if it has no state
+func lastGUID(t *testing.T, name string) string {
+	t.Helper()
+	config, err := loadSources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := findSource(config.Sources, name)
+	if i < 0 {
+		t.Fatalf("no source %q", name)
+	}
+	if config.Sources[i].State == nil {
+		return ""
+	}
+	return config.Sources[i].State.LastGUID
+}
+
+func TestFetchUpdatesFeedKeepsRejectedEntries(t *testing.T) {
+	useTempDataDir(t)
+	body := rssFeed("a|First Post|Mon, 01 Jan 2024 10:00:00 GMT")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+	mustRun(t, "subscribe", server.URL+"/feed.xml", "--yes")
+
+	body = rssFeed("c|Third Post|Wed, 03 Jan 2024 10:00:00 GMT", "b|Second Post|Tue, 02 Jan 2024 10:00:00 GMT",
+		"a|First Post|Mon, 01 Jan 2024 10:00:00 GMT")
+	for _, answers := range []string{"r\n", "p\nn\nn\n"} {
+		if err := fetchUpdates(bufio.NewReader(strings.NewReader(answers)), httpClient, "test-blog", syncOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if guid := lastGUID(t, "test-blog"); guid != "a" {
+			t.Fatalf("after answering %q the feed is at %q, want a so the new posts come again", answers, guid)
+		}
+	}
+	if err := fetchUpdates(bufio.NewReader(strings.NewReader("a\n")), httpClient, "test-blog", syncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if guid := lastGUID(t, "test-blog"); guid != "c" {
+		t.Errorf("after accepting the feed is at %q, want c", guid)
+	}
+	resourceTitled(t, "Second Post")
+	resourceTitled(t, "Third Post")
+}
+
+func TestFetchUpdatesFeedPartialPick(t *testing.T) {
+	useTempDataDir(t)
+	body := rssFeed("a|First Post|Mon, 01 Jan 2024 10:00:00 GMT")
+	etag := `"v1"`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+	mustRun(t, "subscribe", server.URL+"/feed.xml", "--yes")
+
+	body = rssFeed("e|Fifth Post|Fri, 05 Jan 2024 10:00:00 GMT", "d|Fourth Post|Thu, 04 Jan 2024 10:00:00 GMT",
+		"c|Third Post|Wed, 03 Jan 2024 10:00:00 GMT", "b|Second Post|Tue, 02 Jan 2024 10:00:00 GMT",
+		"a|First Post|Mon, 01 Jan 2024 10:00:00 GMT")
+	etag = `"v2"`
+	tests := []struct {
+		answers string
+		want    string
+	}{
+		{"p\nn\ny\nn\nn\n", "a"}, // only c taken, b declined so nothing moves on
+		{"p\ny\nn\nn\n", "c"},    // b taken, c already in, d and e declined
+		{"p\ny\nq\n", "d"},       // d taken, e skipped by quitting
+		{"a\n", "e"},
+	}
+	for _, tt := range tests {
+		if err := fetchUpdates(bufio.NewReader(strings.NewReader(tt.answers)), httpClient, "test-blog", syncOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if guid := lastGUID(t, "test-blog"); guid != tt.want {
+			t.Fatalf("after answering %q the feed is at %q, want %s", tt.answers, guid, tt.want)
+		}
+	}
+	for _, title := range []string{"Second Post", "Third Post", "Fourth Post", "Fifth Post"} {
+		resourceTitled(t, title)
+	}
+	config, err := loadSources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := config.Sources[findSource(config.Sources, "test-blog")].State; state.ETag != etag {
+		t.Errorf("the feed's ETag is %q once everything is in, want %s", state.ETag, etag)
+	}
+}
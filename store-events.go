@@ -0,0 +1,628 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	eventsFile        = "events.jsonl"
+	eventsArchiveFile = "events-archive.jsonl"
+)
+
+// The live log is folded into the snapshots once it grows past this many events.
+const compactAfterEvents = 500
+
+// Event types stored in the log.
+const (
+	eventResourcePut      = "resource.put"
+	eventResourceDelete   = "resource.delete"
+	eventResourcesReplace = "resources.replace"
+	eventPlaylistPut      = "playlist.put"
+	eventPlaylistDelete   = "playlist.delete"
+	eventPlaylistsReplace = "playlists.replace"
+)
+
+// event is one change to the catalog or the playlists, one JSON object per line in the log.
+type event struct {
+	Seq       int64      `json:"seq"`
+	Time      string     `json:"time"`
+	Type      string     `json:"type"`
+	ID        string     `json:"id,omitempty"`
+	Resource  *Resource  `json:"resource,omitempty"`
+	Playlist  *Playlist  `json:"playlist,omitempty"`
+	Resources []Resource `json:"resources,omitempty"`
+	Playlists []Playlist `json:"playlists,omitempty"`
+}
+
+// eventStore keeps an append-only log of changes as the source of truth.
+// resources.json and playlists.json are snapshots of the state after the event
+// recorded in their event_seq field. Loading replays the newer events on top of
+// them, and compaction writes fresh snapshots and moves the log into the archive,
+// which keeps the full history for auditing and rebuilding past states.
+type eventStore struct {
+	snapshots   *jsonStore
+	logPath     string
+	archivePath string
+	lastSeq     int64 // last event this session has seen, used to detect stale saves
+}
+
+// Function to open the event store, starting the log from the snapshots if there is none yet
+func openEventStore(logPath, archivePath, resourcesPath, playlistsPath string) (*eventStore, error) {
+	s := &eventStore{
+		snapshots:   newJSONStore(resourcesPath, playlistsPath),
+		logPath:     logPath,
+		archivePath: archivePath,
+	}
+	err := withFileLock(s.logPath, func() error {
+		_, liveErr := os.Stat(s.logPath)
+		_, archiveErr := os.Stat(s.archivePath)
+		if !os.IsNotExist(liveErr) || !os.IsNotExist(archiveErr) {
+			return nil
+		}
+		// The first events are a full copy of the current data, so any past state can be rebuilt from the log alone
+		resources, playlists, err := s.load()
+		if err != nil {
+			return err
+		}
+		return s.append([]event{
+			{Type: eventResourcesReplace, Resources: resources.List},
+			{Type: eventPlaylistsReplace, Playlists: playlists.List},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Function to read every event in a log file, a missing file has no events
+func readEvents(path string) ([]event, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []event
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			var e event
+			if jerr := json.Unmarshal(data, &e); jerr != nil {
+				// A crash in the middle of an append leaves a partial last line, which is skipped
+				if err == io.EOF {
+					break
+				}
+				return nil, fmt.Errorf("%s line %d: %v", path, line, jerr)
+			}
+			events = append(events, e)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// Function to apply one event to the in-memory state
+func applyEvent(resources *Resources, playlists *Playlists, e event) {
+	switch e.Type {
+	case eventResourcePut:
+		if i := findResourceByID(resources.List, e.Resource.ID); i >= 0 {
+			resources.List[i] = *e.Resource
+		} else {
+			resources.List = append(resources.List, *e.Resource)
+		}
+	case eventResourceDelete:
+		if i := findResourceByID(resources.List, e.ID); i >= 0 {
+			resources.List = append(resources.List[:i], resources.List[i+1:]...)
+		}
+	case eventResourcesReplace:
+		resources.List = append([]Resource(nil), e.Resources...)
+	case eventPlaylistPut:
+		if i := findPlaylistByID(playlists.List, e.Playlist.ID); i >= 0 {
+			playlists.List[i] = *e.Playlist
+		} else {
+			playlists.List = append(playlists.List, *e.Playlist)
+		}
+	case eventPlaylistDelete:
+		if i := findPlaylistByID(playlists.List, e.ID); i >= 0 {
+			playlists.List = append(playlists.List[:i], playlists.List[i+1:]...)
+		}
+	case eventPlaylistsReplace:
+		playlists.List = append([]Playlist(nil), e.Playlists...)
+	}
+}
+
+// Function to build the current state: the snapshots plus every event recorded after them
+func (s *eventStore) load() (Resources, Playlists, error) {
+	resources, err := s.snapshots.LoadResources()
+	if err != nil && !os.IsNotExist(err) {
+		return resources, Playlists{}, err
+	}
+	playlists, err := s.snapshots.LoadPlaylists()
+	if err != nil && !os.IsNotExist(err) {
+		return resources, playlists, err
+	}
+	events, err := readEvents(s.logPath)
+	if err != nil {
+		return resources, playlists, err
+	}
+
+	s.lastSeq = resources.EventSeq
+	if playlists.EventSeq > s.lastSeq {
+		s.lastSeq = playlists.EventSeq
+	}
+	for _, e := range events {
+		isPlaylistEvent := strings.HasPrefix(e.Type, "playlist")
+		if (isPlaylistEvent && e.Seq > playlists.EventSeq) || (!isPlaylistEvent && e.Seq > resources.EventSeq) {
+			applyEvent(&resources, &playlists, e)
+		}
+		if e.Seq > s.lastSeq {
+			s.lastSeq = e.Seq
+		}
+	}
+	return resources, playlists, nil
+}
+
+// Function to find the sequence number of the newest event on disk
+func (s *eventStore) currentSeq() (int64, error) {
+	latest, err := lastEventSeq(s.logPath)
+	if err != nil {
+		return 0, err
+	}
+	if latest > 0 {
+		return latest, nil
+	}
+	// Right after a compaction the live log is empty and the snapshots hold the latest number
+	var header struct {
+		EventSeq int64 `json:"event_seq"`
+	}
+	for _, path := range []string{s.snapshots.resources.path, s.snapshots.playlists.path} {
+		if data, err := ioutil.ReadFile(path); err == nil {
+			json.Unmarshal(data, &header)
+			if header.EventSeq > latest {
+				latest = header.EventSeq
+			}
+		}
+	}
+	return latest, nil
+}
+
+// Function to read the sequence number of the last event in a log, 0 if it has none.
+// The file is read backwards from the end until the last complete line is found, so this
+// doesn't depend on how long the log is. A partial last line left by a crash is skipped,
+// like readEvents does.
+func lastEventSeq(path string) (int64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	const block = 4096
+	var tail []byte
+	for end := info.Size(); end > 0; {
+		start := max(0, end-block)
+		buf := make([]byte, end-start)
+		if _, err := f.ReadAt(buf, start); err != nil {
+			return 0, err
+		}
+		tail = append(buf, tail...)
+		end = start
+		lines := bytes.Split(tail, []byte{'\n'})
+		for i := len(lines) - 1; i >= 0; i-- {
+			// The first line may have started before what has been read so far
+			if i == 0 && start > 0 {
+				break
+			}
+			line := bytes.TrimSpace(lines[i])
+			if len(line) == 0 {
+				continue
+			}
+			var header struct {
+				Seq int64 `json:"seq"`
+			}
+			if err := json.Unmarshal(line, &header); err != nil {
+				if i == len(lines)-1 {
+					continue // no newline yet: a partial append
+				}
+				return 0, fmt.Errorf("%s: last event: %v", path, err)
+			}
+			return header.Seq, nil
+		}
+	}
+	return 0, nil
+}
+
+// Function to cut off a partial last line left by a crash, so new events start on a fresh line
+func repairLog(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) || len(data) == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if data[len(data)-1] == '\n' {
+		return nil
+	}
+	return os.Truncate(path, int64(bytes.LastIndexByte(data, '\n')+1))
+}
+
+// Function to number and append events to the live log. The caller must hold the log lock.
+func (s *eventStore) append(events []event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	seq, err := s.currentSeq()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	var buf bytes.Buffer
+	for i := range events {
+		seq++
+		events[i].Seq = seq
+		events[i].Time = now
+		data, err := json.Marshal(events[i])
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	if err := repairLog(s.logPath); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.lastSeq = seq
+	return nil
+}
+
+// Function to append events built from the current state under the log lock, for the
+// bulk saves. The save is refused if another session added events since this one loaded.
+func (s *eventStore) record(build func(resources Resources, playlists Playlists) ([]event, error)) error {
+	return withFileLock(s.logPath, func() error {
+		seen := s.lastSeq
+		resources, playlists, err := s.load()
+		if err != nil {
+			return err
+		}
+		if s.lastSeq != seen {
+			s.lastSeq = seen
+			return fmt.Errorf("%s was %w; run the command again to work on the latest data", eventsFile, errConflict)
+		}
+		events, err := build(resources, playlists)
+		if err != nil {
+			return err
+		}
+		return s.append(events)
+	})
+}
+
+// Function to append a single-record change under the log lock. Only the tail of the log is
+// read, for the sequence number, so a write costs the same however big the catalog is.
+// lastSeq only moves on if nobody else wrote in between, so the session's next bulk save
+// still notices the other session's events.
+func (s *eventStore) appendChange(e event) error {
+	return withFileLock(s.logPath, func() error {
+		seen := s.lastSeq
+		current, err := s.currentSeq()
+		if err != nil {
+			return err
+		}
+		if err := s.append([]event{e}); err != nil {
+			return err
+		}
+		if current != seen {
+			s.lastSeq = seen
+		}
+		return nil
+	})
+}
+
+func (s *eventStore) LoadResources() (Resources, error) {
+	resources, _, err := s.load()
+	return resources, err
+}
+
+func (s *eventStore) LoadPlaylists() (Playlists, error) {
+	_, playlists, err := s.load()
+	return playlists, err
+}
+
+// SaveResources only logs what differs from the current state.
+func (s *eventStore) SaveResources(resources Resources) error {
+	return s.record(func(current Resources, _ Playlists) ([]event, error) {
+		return diffResourceEvents(current.List, resources.List), nil
+	})
+}
+
+func (s *eventStore) PutResource(resource Resource) error {
+	return s.appendChange(event{Type: eventResourcePut, Resource: &resource})
+}
+
+// DeleteResource doesn't look the ID up, that would mean replaying the log. The catalog
+// checks it first, and replaying the delete of a missing resource does nothing.
+func (s *eventStore) DeleteResource(id string) error {
+	return s.appendChange(event{Type: eventResourceDelete, ID: id})
+}
+
+// SavePlaylists only logs what differs from the current state.
+func (s *eventStore) SavePlaylists(playlists Playlists) error {
+	return s.record(func(_ Resources, current Playlists) ([]event, error) {
+		return diffPlaylistEvents(current.List, playlists.List), nil
+	})
+}
+
+func (s *eventStore) PutPlaylist(playlist Playlist) error {
+	return s.appendChange(event{Type: eventPlaylistPut, Playlist: &playlist})
+}
+
+// DeletePlaylist, like DeleteResource, leaves checking the ID to the caller.
+func (s *eventStore) DeletePlaylist(id string) error {
+	return s.appendChange(event{Type: eventPlaylistDelete, ID: id})
+}
+
+// Close folds a long log into the snapshots so the next start doesn't replay it all.
+func (s *eventStore) Close() error {
+	events, err := readEvents(s.logPath)
+	if err != nil || len(events) < compactAfterEvents {
+		return err
+	}
+	return s.Compact()
+}
+
+// Function to write fresh snapshots and move the live log into the archive
+func (s *eventStore) Compact() error {
+	return withFileLock(s.logPath, func() error {
+		resources, playlists, err := s.load()
+		if err != nil {
+			return err
+		}
+		resources.EventSeq = s.lastSeq
+		playlists.EventSeq = s.lastSeq
+		if err := s.snapshots.SaveResources(resources); err != nil {
+			return err
+		}
+		if err := s.snapshots.SavePlaylists(playlists); err != nil {
+			return err
+		}
+
+		// The snapshots are safe on disk now. If we crash below, the events are skipped on
+		// replay because of event_seq, and a repeated archive copy is skipped by seq too.
+		live, err := ioutil.ReadFile(s.logPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if len(live) > 0 {
+			archive, err := os.OpenFile(s.archivePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return err
+			}
+			if _, err := archive.Write(live); err != nil {
+				archive.Close()
+				return err
+			}
+			if err := archive.Sync(); err != nil {
+				archive.Close()
+				return err
+			}
+			if err := archive.Close(); err != nil {
+				return err
+			}
+		}
+		return writeFileAtomic(s.logPath, nil, 0644)
+	})
+}
+
+// Function to rebuild the state as it was at a point in time by replaying the archive and the live log
+func (s *eventStore) stateAt(at time.Time) (Resources, Playlists, error) {
+	var resources Resources
+	var playlists Playlists
+	archived, err := readEvents(s.archivePath)
+	if err != nil {
+		return resources, playlists, err
+	}
+	live, err := readEvents(s.logPath)
+	if err != nil {
+		return resources, playlists, err
+	}
+
+	applied := int64(0)
+	for _, e := range append(archived, live...) {
+		if e.Seq <= applied {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, e.Time)
+		if err != nil {
+			return resources, playlists, fmt.Errorf("event %d has a bad time %q", e.Seq, e.Time)
+		}
+		if t.After(at) {
+			break
+		}
+		applyEvent(&resources, &playlists, e)
+		applied = e.Seq
+	}
+	return resources, playlists, nil
+}
+
+// Function to replay the archive and the live log line by line for `check`, like the JSON
+// loader does with resources: every line that doesn't decode, event that can't be applied
+// and gap in the numbering is listed. Events copied into the archive twice by a compaction
+// that crashed are skipped like on replay, and so is a partial last line in the live log,
+// the next append cuts it off. Returns the problems and how many events there are.
+func (s *eventStore) checkLogs() ([]string, int, error) {
+	var problems []string
+	count, last := 0, int64(0)
+	for _, path := range []string{s.archivePath, s.logPath} {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		name := filepath.Base(path)
+		lines := bytes.Split(data, []byte{'\n'})
+		for n, line := range lines {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var e event
+			if err := json.Unmarshal(line, &e); err != nil {
+				if path == s.logPath && n == len(lines)-1 {
+					continue
+				}
+				problems = append(problems, fmt.Sprintf("%s line %d: %v", name, n+1, err))
+				continue
+			}
+			if e.Seq <= last {
+				continue
+			}
+			if last > 0 && e.Seq > last+1 {
+				problems = append(problems, fmt.Sprintf("%s line %d: events %d to %d are missing before event %d", name, n+1, last+1, e.Seq-1, e.Seq))
+			}
+			if fault := eventFault(e); fault != "" {
+				problems = append(problems, fmt.Sprintf("%s line %d, event %d: %s", name, n+1, e.Seq, fault))
+			}
+			count++
+			last = e.Seq
+		}
+	}
+	return problems, count, nil
+}
+
+// Function to describe what's wrong with an event that replaying would trip over, "" if nothing
+func eventFault(e event) string {
+	if _, err := time.Parse(time.RFC3339Nano, e.Time); err != nil {
+		return fmt.Sprintf("bad time %q", e.Time)
+	}
+	switch e.Type {
+	case eventResourcePut:
+		if e.Resource == nil {
+			return "no resource to put"
+		}
+		return resourceFault(*e.Resource)
+	case eventPlaylistPut:
+		if e.Playlist == nil {
+			return "no playlist to put"
+		}
+	case eventResourceDelete, eventPlaylistDelete:
+		if strings.TrimSpace(e.ID) == "" {
+			return "no id to delete"
+		}
+	case eventResourcesReplace:
+		for _, r := range e.Resources {
+			if fault := resourceFault(r); fault != "" {
+				return fmt.Sprintf("resource %q: %s", r.ID, fault)
+			}
+		}
+	case eventPlaylistsReplace:
+	default:
+		return fmt.Sprintf("unknown event type %q", e.Type)
+	}
+	return ""
+}
+
+// Function to turn the difference between two catalogs into put/delete events.
+// If the order changed in a way puts and deletes can't express, the whole list is replaced.
+func diffResourceEvents(current, wanted []Resource) []event {
+	var events []event
+	wantedIDs := make(map[string]bool, len(wanted))
+	for _, r := range wanted {
+		wantedIDs[strings.ToLower(r.ID)] = true
+	}
+	var replayed Resources
+	replayed.List = append(replayed.List, current...)
+	for _, r := range current {
+		if !wantedIDs[strings.ToLower(r.ID)] {
+			e := event{Type: eventResourceDelete, ID: r.ID}
+			events = append(events, e)
+			applyEvent(&replayed, nil, e)
+		}
+	}
+	for i := range wanted {
+		j := findResourceByID(replayed.List, wanted[i].ID)
+		if j >= 0 && sameJSON(replayed.List[j], wanted[i]) {
+			continue
+		}
+		e := event{Type: eventResourcePut, Resource: &wanted[i]}
+		events = append(events, e)
+		applyEvent(&replayed, nil, e)
+	}
+	if len(wanted) > 0 && !sameJSON(replayed.List, wanted) {
+		return []event{{Type: eventResourcesReplace, Resources: wanted}}
+	}
+	return events
+}
+
+// Function to turn the difference between two playlist lists into put/delete events
+func diffPlaylistEvents(current, wanted []Playlist) []event {
+	var events []event
+	wantedIDs := make(map[string]bool, len(wanted))
+	for _, p := range wanted {
+		wantedIDs[strings.ToLower(p.ID)] = true
+	}
+	var replayed Playlists
+	replayed.List = append(replayed.List, current...)
+	for _, p := range current {
+		if !wantedIDs[strings.ToLower(p.ID)] {
+			e := event{Type: eventPlaylistDelete, ID: p.ID}
+			events = append(events, e)
+			applyEvent(nil, &replayed, e)
+		}
+	}
+	for i := range wanted {
+		j := findPlaylistByID(replayed.List, wanted[i].ID)
+		if j >= 0 && sameJSON(replayed.List[j], wanted[i]) {
+			continue
+		}
+		e := event{Type: eventPlaylistPut, Playlist: &wanted[i]}
+		events = append(events, e)
+		applyEvent(nil, &replayed, e)
+	}
+	if len(wanted) > 0 && !sameJSON(replayed.List, wanted) {
+		return []event{{Type: eventPlaylistsReplace, Playlists: wanted}}
+	}
+	return events
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLastEventSeq(t *testing.T) {
+	long := `{"seq":7,"type":"resources.replace","resources":[{"id":"` + strings.Repeat("x", 10000) + `"}]}`
+	tests := []struct {
+		name string
+		log  string
+		want int64
+	}{
+		{"empty", "", 0},
+		{"one event", `{"seq":1,"type":"resource.put"}` + "\n", 1},
+		{"several", `{"seq":1}` + "\n" + `{"seq":2}` + "\n" + `{"seq":3}` + "\n", 3},
+		{"blank lines at the end", `{"seq":4}` + "\n\n\n", 4},
+		{"partial last line", `{"seq":1}` + "\n" + `{"seq":2}` + "\n" + `{"seq":3,"ty`, 2},
+		{"last line longer than a block", `{"seq":6}` + "\n" + long + "\n", 7},
+		{"only line longer than a block", long + "\n", 7},
+		{"short line after a long one", long + "\n" + `{"seq":8}` + "\n", 8},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, "events.jsonl")
+		if err := os.WriteFile(path, []byte(tt.log), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := lastEventSeq(path)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: lastEventSeq = %d, %v; want %d", tt.name, got, err, tt.want)
+		}
+	}
+	if got, err := lastEventSeq(filepath.Join(dir, "missing.jsonl")); got != 0 || err != nil {
+		t.Errorf("missing log: lastEventSeq = %d, %v; want 0", got, err)
+	}
+	os.WriteFile(filepath.Join(dir, "bad.jsonl"), []byte("{\"seq\":1}\nnot json\n"), 0644)
+	if _, err := lastEventSeq(filepath.Join(dir, "bad.jsonl")); err == nil {
+		t.Error("a broken last line wasn't reported")
+	}
+}
+
+func TestCheckLogs(t *testing.T) {
+	ev := func(seq int, rest string) string {
+		return fmt.Sprintf(`{"seq":%d,"time":"2024-01-01T10:00:00Z",%s}`, seq, rest) + "\n"
+	}
+	put := func(seq int) string { return ev(seq, `"type":"resource.put","resource":{"id":"a1","title":"A"}`) }
+	tests := []struct {
+		name          string
+		archive, live string
+		count         int
+		problems      []string
+	}{
+		{"clean", put(1) + put(2), put(3), 3, nil},
+		{"no archive", "", put(1) + put(2), 2, nil},
+		{"copied into the archive twice", put(1) + put(2) + put(1) + put(2), put(3), 3, nil},
+		{"partial last line", put(1), put(2) + `{"seq":3,"ty`, 2, nil},
+		{"gap between the logs", put(1) + put(2), put(5), 3, []string{"events.jsonl line 1: events 3 to 4 are missing before event 5"}},
+		{"undecodable lines", put(1) + "not json\n", put(2) + "{\"seq\":\n" + put(3), 3,
+			[]string{"events-archive.jsonl line 2: invalid character", "events.jsonl line 2: unexpected end of JSON input"}},
+		{"partial line in the archive", put(1) + `{"seq":2`, put(2), 2, []string{"events-archive.jsonl line 2: unexpected end"}},
+		{"events that can't be applied", "",
+			ev(1, `"type":"resource.put"`) + ev(2, `"type":"resource.delete"`) + ev(3, `"type":"resource.move"`) +
+				ev(4, `"type":"resources.replace","resources":[{"id":"a1"}]`) + `{"seq":5,"time":"soon","type":"playlists.replace"}` + "\n", 5,
+			[]string{"events.jsonl line 1, event 1: no resource to put", "events.jsonl line 2, event 2: no id to delete",
+				`events.jsonl line 3, event 3: unknown event type "resource.move"`, `events.jsonl line 4, event 4: resource "a1": title is missing`,
+				`events.jsonl line 5, event 5: bad time "soon"`}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		s := &eventStore{logPath: filepath.Join(dir, eventsFile), archivePath: filepath.Join(dir, eventsArchiveFile)}
+		if tt.archive != "" {
+			os.WriteFile(s.archivePath, []byte(tt.archive), 0644)
+		}
+		os.WriteFile(s.logPath, []byte(tt.live), 0644)
+		problems, count, err := s.checkLogs()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		ok := count == tt.count && len(problems) == len(tt.problems)
+		for i := 0; ok && i < len(problems); i++ {
+			ok = strings.HasPrefix(problems[i], tt.problems[i])
+		}
+		if !ok {
+			t.Errorf("%s: %d event(s) with problems %q, want %d and %q", tt.name, count, problems, tt.count, tt.problems)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+)
+
+// jsonStore keeps resources and playlists in two JSON files.
+// Every write rewrites the whole file through a locked temp-file-and-rename.
+type jsonStore struct {
+	resources jsonFile
+	playlists jsonFile
+}
+
+func newJSONStore(resourcesPath, playlistsPath string) *jsonStore {
+	s := &jsonStore{
+		resources: jsonFile{path: resourcesPath, listKey: "resources", chain: resourceMigrations},
+		playlists: jsonFile{path: playlistsPath, listKey: "playlists", chain: playlistMigrations},
+	}
+	s.resources.decode = func(original, migrated []byte, v interface{}) error {
+		return decodeCatalog(resourcesPath, original, migrated, v.(*Resources), *lenientLoad)
+	}
+	return s
+}
+
+func (s *jsonStore) LoadResources() (Resources, error) {
+	var resources Resources
+	err := s.resources.read(&resources)
+	return resources, err
+}
+
+func (s *jsonStore) SaveResources(resources Resources) error {
+	resources.Version = resourcesSchemaVersion
+	return s.resources.save(resources)
+}
+
+func (s *jsonStore) PutResource(resource Resource) error {
+	var resources Resources
+	return s.resources.update(&resources, func() error {
+		for i, r := range resources.List {
+			if strings.EqualFold(r.ID, resource.ID) {
+				resources.List[i] = resource
+				return nil
+			}
+		}
+		resources.List = append(resources.List, resource)
+		return nil
+	})
+}
+
+func (s *jsonStore) DeleteResource(id string) error {
+	var resources Resources
+	return s.resources.update(&resources, func() error {
+		for i, r := range resources.List {
+			if strings.EqualFold(r.ID, id) {
+				resources.List = append(resources.List[:i], resources.List[i+1:]...)
+				return nil
+			}
+		}
+		return errResourceNotFound
+	})
+}
+
+func (s *jsonStore) LoadPlaylists() (Playlists, error) {
+	var playlists Playlists
+	err := s.playlists.read(&playlists)
+	return playlists, err
+}
+
+func (s *jsonStore) SavePlaylists(playlists Playlists) error {
+	playlists.Version = playlistsSchemaVersion
+	return s.playlists.save(playlists)
+}
+
+func (s *jsonStore) PutPlaylist(playlist Playlist) error {
+	var playlists Playlists
+	return s.playlists.update(&playlists, func() error {
+		for i, p := range playlists.List {
+			if strings.EqualFold(p.ID, playlist.ID) {
+				playlists.List[i] = playlist
+				return nil
+			}
+		}
+		playlists.List = append(playlists.List, playlist)
+		return nil
+	})
+}
+
+func (s *jsonStore) DeletePlaylist(id string) error {
+	var playlists Playlists
+	return s.playlists.update(&playlists, func() error {
+		for i, p := range playlists.List {
+			if strings.EqualFold(p.ID, id) {
+				playlists.List = append(playlists.List[:i], playlists.List[i+1:]...)
+				return nil
+			}
+		}
+		return errPlaylistNotFound
+	})
+}
+
+func (s *jsonStore) Close() error {
+	return nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	_ "modernc.org/sqlite" // pure Go SQLite driver, no cgo needed
+)
+
+// sqliteStore keeps resources and playlists in an embedded SQLite database.
+// Each row stores the full record as JSON in the data column, the other
+// columns only exist for ordering and lookups.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// Version 2 stores rows in the current resource/playlist format.
+// Databases at version 1 still hold playlists with embedded resources.
+const sqliteSchemaVersion = 2
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS resources (
+	id       TEXT PRIMARY KEY COLLATE NOCASE,
+	position INTEGER NOT NULL,
+	genre    TEXT NOT NULL DEFAULT '',
+	status   TEXT NOT NULL DEFAULT '',
+	type     TEXT NOT NULL DEFAULT '',
+	data     TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS resources_position ON resources(position);
+CREATE INDEX IF NOT EXISTS resources_genre ON resources(genre COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS resources_status ON resources(status COLLATE NOCASE);
+
+CREATE TABLE IF NOT EXISTS playlists (
+	id       TEXT PRIMARY KEY COLLATE NOCASE,
+	position INTEGER NOT NULL,
+	name     TEXT NOT NULL DEFAULT '',
+	data     TEXT NOT NULL
+);
+`
+
+// Function to open (and create if needed) the SQLite database.
+// A brand new database is seeded from the JSON files when they exist.
+func openSQLiteStore(path, resourcesPath, playlistsPath string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows one writer, so a single connection avoids "database is locked" errors.
+	db.SetMaxOpenConns(1)
+	s := &sqliteStore{db: db}
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating schema: %v", err)
+	}
+	if version == 0 {
+		if err := s.importJSON(resourcesPath, playlistsPath); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error importing JSON files: %v", err)
+		}
+	} else if version < sqliteSchemaVersion {
+		if err := s.migrateRows("resources", resourceMigrations); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error migrating resources: %v", err)
+		}
+		if err := s.migrateRows("playlists", playlistMigrations); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error migrating playlists: %v", err)
+		}
+	} else if version > sqliteSchemaVersion {
+		db.Close()
+		return nil, fmt.Errorf("%s has schema version %d but this outgo only knows up to %d; please upgrade outgo", path, version, sqliteSchemaVersion)
+	}
+	if version != sqliteSchemaVersion {
+		if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", sqliteSchemaVersion)); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Function to run a migration chain over the JSON data of every row in table
+func (s *sqliteStore) migrateRows(table string, chain []migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, data FROM " + table)
+	if err != nil {
+		return err
+	}
+	updates := make(map[string][]byte)
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			rows.Close()
+			return err
+		}
+		migrated, changed, err := migrateEntry([]byte(data), chain)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("row %s: %v", id, err)
+		}
+		if changed {
+			updates[id] = migrated
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, data := range updates {
+		if _, err := tx.Exec("UPDATE "+table+" SET data = ? WHERE id = ?", string(data), id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Function to copy the existing JSON catalog into a fresh database
+func (s *sqliteStore) importJSON(resourcesPath, playlistsPath string) error {
+	files := newJSONStore(resourcesPath, playlistsPath)
+	if _, err := os.Stat(resourcesPath); err == nil {
+		resources, err := files.LoadResources()
+		if err != nil {
+			return err
+		}
+		if err := s.SaveResources(resources); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(playlistsPath); err == nil {
+		playlists, err := files.LoadPlaylists()
+		if err != nil {
+			return err
+		}
+		if err := s.SavePlaylists(playlists); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) LoadResources() (Resources, error) {
+	var resources Resources
+	rows, err := s.db.Query("SELECT data FROM resources ORDER BY position")
+	if err != nil {
+		return resources, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return resources, err
+		}
+		var r Resource
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			return resources, err
+		}
+		resources.List = append(resources.List, r)
+	}
+	return resources, rows.Err()
+}
+
+// Function to validate every resource row like the JSON loader does, for `check`.
+// Returns the problems and how many rows there are.
+func (s *sqliteStore) checkResources() ([]string, int, error) {
+	rows, err := s.db.Query("SELECT id, data FROM resources ORDER BY position")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var problems []string
+	count := 0
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, 0, err
+		}
+		count++
+		var r Resource
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			problems = append(problems, fmt.Sprintf("row %d, id %q: %v", count, id, err))
+		} else if fault := resourceFault(r); fault != "" {
+			problems = append(problems, fmt.Sprintf("row %d, id %q: %s", count, id, fault))
+		} else if !strings.EqualFold(r.ID, id) {
+			problems = append(problems, fmt.Sprintf("row %d, id %q: the data says its id is %q", count, id, r.ID))
+		}
+	}
+	return problems, count, rows.Err()
+}
+
+func (s *sqliteStore) SaveResources(resources Resources) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM resources"); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("INSERT INTO resources (id, position, genre, status, type, data) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i, r := range resources.List {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(r.ID, i+1, r.Genre, r.Status, r.Type, string(data)); err != nil {
+			return fmt.Errorf("error saving resource %s: %v", r.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) PutResource(resource Resource) error {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+INSERT INTO resources (id, position, genre, status, type, data)
+VALUES (?, (SELECT COALESCE(MAX(position), 0) + 1 FROM resources), ?, ?, ?, ?)
+ON CONFLICT(id) DO UPDATE SET genre = excluded.genre, status = excluded.status, type = excluded.type, data = excluded.data`,
+		resource.ID, resource.Genre, resource.Status, resource.Type, string(data))
+	return err
+}
+
+func (s *sqliteStore) DeleteResource(id string) error {
+	res, err := s.db.Exec("DELETE FROM resources WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errResourceNotFound
+	}
+	return nil
+}
+
+func (s *sqliteStore) LoadPlaylists() (Playlists, error) {
+	var playlists Playlists
+	rows, err := s.db.Query("SELECT data FROM playlists ORDER BY position")
+	if err != nil {
+		return playlists, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return playlists, err
+		}
+		var p Playlist
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			return playlists, err
+		}
+		playlists.List = append(playlists.List, p)
+	}
+	return playlists, rows.Err()
+}
+
+func (s *sqliteStore) SavePlaylists(playlists Playlists) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM playlists"); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("INSERT INTO playlists (id, position, name, data) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i, p := range playlists.List {
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(p.ID, i+1, p.Name, string(data)); err != nil {
+			return fmt.Errorf("error saving playlist %s: %v", p.Name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) PutPlaylist(playlist Playlist) error {
+	data, err := json.Marshal(playlist)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+INSERT INTO playlists (id, position, name, data)
+VALUES (?, (SELECT COALESCE(MAX(position), 0) + 1 FROM playlists), ?, ?)
+ON CONFLICT(id) DO UPDATE SET name = excluded.name, data = excluded.data`,
+		playlist.ID, playlist.Name, string(data))
+	return err
+}
+
+func (s *sqliteStore) DeletePlaylist(id string) error {
+	res, err := s.db.Exec("DELETE FROM playlists WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errPlaylistNotFound
+	}
+	return nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
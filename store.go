@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/fatih/color"
+)
+
+// ResourceStore persists the resource catalog.
+// SaveResources replaces the whole catalog, while PutResource and DeleteResource
+// only touch a single entry so backends can avoid rewriting everything.
+type ResourceStore interface {
+	LoadResources() (Resources, error)
+	SaveResources(resources Resources) error
+	PutResource(resource Resource) error
+	DeleteResource(id string) error
+}
+
+// PlaylistStore persists the user's playlists.
+type PlaylistStore interface {
+	LoadPlaylists() (Playlists, error)
+	SavePlaylists(playlists Playlists) error
+	PutPlaylist(playlist Playlist) error
+	DeletePlaylist(id string) error
+}
+
+// Store is a storage backend holding both resources and playlists.
+type Store interface {
+	ResourceStore
+	PlaylistStore
+	Close() error
+}
+
+var (
+	errResourceNotFound = errors.New("resource not found")
+	errPlaylistNotFound = errors.New("playlist not found")
+)
+
+// Storage backends that can be chosen with the -store flag.
+const (
+	storeEvents = "events"
+	storeJSON   = "json"
+	storeSQLite = "sqlite"
+)
+
+const sqliteFile = "outgo.db"
+
+var storeBackend = flag.String("store", storeEvents, "storage backend to use (events, json or sqlite)")
+
+// store is the backend used by every command for this session.
+var store Store
+
+// Function to get the JSON files behind the current store, if it has any
+func jsonFiles() (*jsonStore, bool) {
+	switch s := store.(type) {
+	case *jsonStore:
+		return s, true
+	case *eventStore:
+		return s.snapshots, true
+	}
+	return nil, false
+}
+
+// Function to open the storage backend by name
+func openStore(backend string) (Store, error) {
+	switch backend {
+	case storeEvents, "":
+		return openEventStore(dataPath(eventsFile), dataPath(eventsArchiveFile), dataPath(resourcesFile), dataPath(playlistsFile))
+	case storeJSON:
+		// Changes made with the event store that aren't compacted yet are not in the JSON files
+		if events, err := readEvents(dataPath(eventsFile)); err == nil && len(events) > 0 {
+			color.Yellow("Warning: %s has %d change(s) that are not in the JSON files yet, run `compact` with the events store first.", eventsFile, len(events))
+		}
+		return newJSONStore(dataPath(resourcesFile), dataPath(playlistsFile)), nil
+	case storeSQLite:
+		return openSQLiteStore(dataPath(sqliteFile), dataPath(resourcesFile), dataPath(playlistsFile))
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (expected %s, %s or %s)", backend, storeEvents, storeJSON, storeSQLite)
+	}
+}
@@ -1,141 +1,224 @@
 package main
 
 import (
-	"encoding/csv"
-	"encoding/json"
+	"bufio"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"os"
-	"strconv"
+	"sort"
 	"strings"
-)
-
-// Assuming InputForm type is similar to UpdateInputs
-type InputForm struct {
-	ID     string   `json:"id"`
-	Title  string   `json:"title"`
-	Author string   `json:"author"`
-	Link   string   `json:"link"`
-	Genre  string   `json:"genre"`
-	Status string   `json:"status"`
-	Tags   []string `json:"tags"`
-	Type   string   `json:"type"`
-}
 
-// ResourceFileArticle structure to hold resources
-type ResourceFileUpdateInputs struct {
-	Resources []InputForm `json:"resources"`
-}
+	"github.com/fatih/color"
+)
 
-// Function to check if an article exists
-func InputExists(articles []InputForm, title string) bool {
-	for _, a := range articles {
-		if a.Title == title {
-			return true
+// Function to find a catalog entry by its exact title, returns -1 if there is none
+func findResourceByTitle(resources []Resource, title string) int {
+	for i, r := range resources {
+		if r.Title == title {
+			return i
 		}
 	}
-	return false
+	return -1
 }
 
-// Function to generate a unique ID based on genre
-func generateID(genre string, resourceFile ResourceFileUpdateInputs) string {
-	maxID := 0
-
-	// Iterate over existing resources to find the highest ID for the given genre
-	for _, article := range resourceFile.Resources {
-		if strings.HasPrefix(article.ID, genre) {
-			idNum, err := strconv.Atoi(strings.TrimPrefix(article.ID, genre))
-			if err == nil && idNum > maxID {
-				maxID = idNum
-			}
+// Function to bring a resource up to date with its row in a source. The source owns the
+// descriptive fields it has; the status, rating and the rest of what's tracked locally are kept.
+func mergeSheetRow(existing, row Resource) Resource {
+	merged := existing
+	if row.Title != "" {
+		merged.Title = row.Title
+	}
+	if row.Author != "" {
+		merged.Author = row.Author
+	}
+	if row.Link != "" {
+		merged.Link = row.Link
+	}
+	if row.Genre != "" {
+		merged.Genre = row.Genre
+	}
+	if row.Type != "" {
+		merged.Type = row.Type
+	}
+	// Tags are added, never taken away, as other sources or the user may have set them
+	merged.Tags = append([]string{}, existing.Tags...)
+	for _, tag := range row.Tags {
+		if !containsFold(merged.Tags, tag) {
+			merged.Tags = append(merged.Tags, tag)
 		}
 	}
-
-	// Generate new ID by incrementing the highest found ID
-	newID := fmt.Sprintf("%s%d", genre, maxID+1)
-	return newID
+	return merged
 }
 
-// New function to save articles with type
-func updateResourcesWithType(sheetID string) error {
-	// Construct the URL to fetch CSV data for a specific range (A:F)
-	csvURL := fmt.Sprintf("https://docs.google.com/spreadsheets/d/%s/gviz/tq?tqx=out:csv&range=A:F", sheetID)
+// syncOptions are the flags of fetch-updates.
+type syncOptions struct {
+	dryRun bool // only show the diff
+	yes    bool // apply everything without asking
+}
 
-	// Fetch the CSV data
-	resp, err := http.Get(csvURL)
+// Function to show what syncing rows would change, let the user accept all of it, none
+// of it or pick, and save what was accepted with a backup and a history entry. settled
+// tells for each row whether the catalog is in sync with it afterwards: its change was
+// saved, or it needed none. A dry run or rejecting everything leaves the changed rows out.
+func syncResources(reader *bufio.Reader, command string, batch importBatch, opts syncOptions) (settled []bool, err error) {
+	resources, err := loadResources()
 	if err != nil {
-		return fmt.Errorf("error fetching CSV: %v", err)
+		return nil, fmt.Errorf("loading resources: %w", err)
 	}
-	defer resp.Body.Close()
-	// Parse the CSV
-	reader := csv.NewReader(resp.Body)
-	reader.LazyQuotes = true       // Allow lazy quotes
-	reader.TrimLeadingSpace = true // Trim leading space
-
-	rows, err := reader.ReadAll()
-	if err != nil {
-		return fmt.Errorf("error reading CSV: %v", err)
+	batch.merge = mergeSheetRow
+	rows, source := batch.resources, batch.source
+	plan := planImport(resources.List, batch)
+	unchanged := plan.duplicates - len(plan.updates)
+	color.Cyan("%d row(s) in %s: %d new, %d updated, %d unchanged.", len(rows), source, len(plan.added), len(plan.updates), unchanged)
+	if len(plan.added) == 0 && len(plan.updates) == 0 {
+		color.Green("The catalog is up to date.")
+		return plan.settled(plan), nil
 	}
 
-	var newInputForms []InputForm
-
-	// Process the CSV data
-	for i, row := range rows {
-		if i == 0 {
-			continue // Skip the header row
+	none := importPlan{ids: plan.ids}
+	diff := plan.diff(resources.List)
+	printCatalogDiff(diff, 50)
+	printGenreCounts(diff)
+	if opts.dryRun {
+		color.Yellow("Dry run: nothing was saved.")
+		return plan.settled(none), nil
+	}
+	picked := plan
+	if !opts.yes {
+		fmt.Print("Apply these changes? [a]ccept all, [r]eject all, [p]ick: ")
+		answer, _ := reader.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "a", "accept":
+		case "p", "pick":
+			picked = pickChanges(reader, plan)
+		default:
+			color.Yellow("Nothing was saved.")
+			return plan.settled(none), nil
 		}
-		if len(row) < 6 {
-			continue // Ensure there are enough columns
+		if len(picked.added) == 0 && len(picked.updates) == 0 {
+			color.Yellow("Nothing picked, nothing was saved.")
+			return plan.settled(none), nil
 		}
+	}
 
-		article := InputForm{
-			ID:     generateID(strings.TrimSpace(row[3]), ResourceFileUpdateInputs{}),
-			Title:  strings.TrimSpace(row[0]),
-			Author: strings.TrimSpace(row[1]),
-			Link:   strings.TrimSpace(row[2]),
-			Genre:  strings.TrimSpace(row[3]),
-			Status: "unread", // Default status
-			Tags:   strings.Split(strings.TrimSpace(row[4]), ","),
-			Type:   strings.TrimSpace(row[5]),
-		}
+	// Keep a copy of the catalog in case the sheet brought in something broken
+	if err := backupBefore(command); err != nil {
+		return nil, err
+	}
+	changes := picked.apply(&resources)
+	if err := saveResources(resources); err != nil {
+		return nil, err
+	}
+	recordOperation(journalEntry{
+		Command:     command,
+		Description: fmt.Sprintf("added %d and updated %d resources from %s", len(picked.added), len(picked.updates), source),
+		Resources:   changes,
+	})
+	color.Green("Added %d new resource(s) and updated %d.", len(picked.added), len(picked.updates))
+	return plan.settled(picked), nil
+}
 
-		if !InputExists(newInputForms, article.Title) {
-			newInputForms = append(newInputForms, article)
-		}
+// Function to tell for each row of a plan's batch whether it is in the catalog as the batch
+// has it once the picked part of the plan is applied: it needed no change, or its change was picked
+func (plan importPlan) settled(picked importPlan) []bool {
+	pending := make(map[string]bool)
+	for _, r := range plan.added {
+		pending[r.ID] = true
+	}
+	for _, c := range plan.updates {
+		pending[c.ID] = true
+	}
+	for _, r := range picked.added {
+		delete(pending, r.ID)
+	}
+	for _, c := range picked.updates {
+		delete(pending, c.ID)
+	}
+	settled := make([]bool, len(plan.ids))
+	for n, id := range plan.ids {
+		settled[n] = !pending[id]
 	}
-	// Save new articles to resources.json
-	return saveInputFormsWithType(newInputForms)
+	return settled
 }
 
-func saveInputFormsWithType(articles []InputForm) error {
-	filePath := "resources.json"
+// Function to turn a plan into a diff against the catalog, for printCatalogDiff. The plan is
+// applied to a copy and compared with the catalog, so the diff holds whatever it would change.
+func (plan importPlan) diff(catalog []Resource) catalogDiff {
+	after := Resources{List: append([]Resource(nil), catalog...)}
+	plan.apply(&after)
+	return diffCatalogs(catalog, after.List)
+}
 
-	// Read existing articles from JSON file
-	var resourceFile ResourceFileUpdateInputs
-	if _, err := os.Stat(filePath); err == nil {
-		// File exists, so load the existing data
-		file, err := ioutil.ReadFile(filePath)
-		if err != nil {
-			return err
+// Function to print how many resources each genre gains, changes and loses
+func printGenreCounts(d catalogDiff) {
+	type counts struct{ added, changed, removed int }
+	byGenre := make(map[string]*counts)
+	count := func(genre string) *counts {
+		if genre == "" {
+			genre = "(none)"
 		}
-		if err := json.Unmarshal(file, &resourceFile); err != nil {
-			return err
+		if byGenre[genre] == nil {
+			byGenre[genre] = &counts{}
 		}
+		return byGenre[genre]
 	}
-
-	// Add the new articles to the existing list
-	resourceFile.Resources = append(resourceFile.Resources, articles...)
-
-	// Write the updated list back to the file
-	data, err := json.MarshalIndent(resourceFile, "", "  ")
-	if err != nil {
-		return err
+	for _, r := range d.Added {
+		count(r.Genre).added++
+	}
+	for _, p := range d.Changed {
+		count(p.New.Genre).changed++
 	}
-	if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
-		return err
+	for _, r := range d.Removed {
+		count(r.Genre).removed++
 	}
+	genres := make([]string, 0, len(byGenre))
+	for genre := range byGenre {
+		genres = append(genres, genre)
+	}
+	sort.Strings(genres)
+
+	fmt.Println("By genre:")
+	for _, genre := range genres {
+		c := byGenre[genre]
+		line := fmt.Sprintf("  %-20s %s %s", genre, color.GreenString("+%-4d", c.added), color.YellowString("~%-4d", c.changed))
+		if len(d.Removed) > 0 {
+			line += " " + color.RedString("-%-4d", c.removed)
+		}
+		fmt.Println(line)
+	}
+}
 
-	fmt.Printf("Successfully saved %d new articles to resources.json\n", len(articles))
-	return nil
+// Function to go through a plan's changes one at a time and keep the ones the user accepts
+func pickChanges(reader *bufio.Reader, plan importPlan) importPlan {
+	picked := importPlan{ids: plan.ids, duplicates: plan.duplicates}
+	all, quit := false, false
+	ask := func(line string) bool {
+		for !all && !quit {
+			fmt.Printf("%s  [y]es, [n]o, [a]ll the rest, [q]uit: ", line)
+			answer, err := reader.ReadString('\n')
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y", "yes":
+				return true
+			case "n", "no":
+				return false
+			case "a", "all":
+				all = true
+			case "q", "quit":
+				quit = true
+			default:
+				quit = err != nil // Out of input
+			}
+		}
+		return all
+	}
+	for _, r := range plan.added {
+		if ask(color.GreenString("+ %s  %s", r.ID, r.Title)) {
+			picked.added = append(picked.added, r)
+		}
+	}
+	for _, c := range plan.updates {
+		fields := strings.Join(changedFields(*c.Before, *c.After), ", ")
+		if ask(color.YellowString("~ %s  %s (%s)", c.ID, c.After.Title, fields)) {
+			picked.updates = append(picked.updates, c)
+		}
+	}
+	return picked
 }